@@ -41,6 +41,11 @@ const AppContent: React.FC = () => {
     last_updated: undefined,
   });
   const [status, setStatus] = useState<string | null>(null);
+  // Paging state of the listing shown in the table: where the next page
+  // comes from, its cursor, and how many instances match in total.
+  const [pageSource, setPageSource] = useState<'list' | 'filter'>('list');
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
+  const [totalInstances, setTotalInstances] = useState<number>(0);
   const [isAuthenticated, setIsAuthenticated] = useState<boolean>(false);
   const [token, setToken] = useState<string | null>(localStorage.getItem('token'));
   const [loading, setLoading] = useState<boolean>(true); // Προστέθηκε loading state
@@ -82,22 +87,29 @@ const AppContent: React.FC = () => {
     validateToken();
   }, [token, navigate]);
 
-  const fetchInstances = async () => {
+  const toInstances = (data: any): Instance[] =>
+    Array.isArray(data.instances)
+      ? data.instances.map((item: any) => ({
+          uuid: item.uuid || '',
+          deviceType: item.deviceType || '',
+          applicationType: item.applicationType || '',
+          status: item.status || 'active',
+          lastUpdated: item.lastUpdated || '',
+        }))
+      : [];
+
+  const fetchInstances = async (cursor?: string) => {
     try {
       const response = await axios.get('http://localhost:8000/api/akri-instances', {
         headers: { Authorization: `Bearer ${token}` },
         withCredentials: true,
+        params: cursor ? { cursor } : {},
       });
-      const fetchedInstances = Array.isArray(response.data.instances)
-        ? response.data.instances.map((item: any) => ({
-            uuid: item.uuid || '',
-            deviceType: item.deviceType || '',
-            applicationType: item.applicationType || '',
-            status: item.status || 'active',
-            lastUpdated: item.lastUpdated || '',
-          }))
-        : [];
-      setFilteredInstances(fetchedInstances);
+      const fetchedInstances = toInstances(response.data);
+      setFilteredInstances(previous => (cursor ? [...previous, ...fetchedInstances] : fetchedInstances));
+      setPageSource('list');
+      setNextCursor(response.data.nextCursor || null);
+      setTotalInstances(response.data.total || 0);
       if (response.data.error) {
         setStatus(`Warning: ${response.data.error}`);
       } else {
@@ -113,26 +125,24 @@ const AppContent: React.FC = () => {
         setStatus(`Error fetching instances: ${error instanceof Error ? error.message : 'Unknown error'}`);
       }
       setFilteredInstances([]);
+      setNextCursor(null);
     }
   };
 
-  const handleFilter = async () => {
+  const handleFilter = async (cursor?: string) => {
     try {
-      const response = await axios.post('http://localhost:8000/api/filter-instances', filters, {
+      const response = await axios.post('http://localhost:8000/api/filter-instances', { ...filters, cursor }, {
         headers: { Authorization: `Bearer ${token}` },
         withCredentials: true,
       });
-      const filteredData = Array.isArray(response.data)
-        ? response.data.map((item: any) => ({
-            uuid: item.uuid || '',
-            deviceType: item.deviceType || '',
-            applicationType: item.applicationType || '',
-            status: item.status || 'active',
-            lastUpdated: item.lastUpdated || '',
-          }))
-        : [];
-      setFilteredInstances(filteredData);
-      setSelectedUuids([]);
+      const filteredData = toInstances(response.data);
+      setFilteredInstances(previous => (cursor ? [...previous, ...filteredData] : filteredData));
+      setPageSource('filter');
+      setNextCursor(response.data.nextCursor || null);
+      setTotalInstances(response.data.total || 0);
+      if (!cursor) {
+        setSelectedUuids([]);
+      }
       setStatus(filteredData.length > 0 ? 'Instances filtered successfully' : 'No instances matched the filters');
     } catch (error) {
       if (axios.isAxiosError(error) && error.response?.status === 401) {
@@ -144,6 +154,16 @@ const AppContent: React.FC = () => {
         setStatus(`Error filtering instances: ${error instanceof Error ? error.message : 'Unknown error'}`);
       }
       setFilteredInstances([]);
+      setNextCursor(null);
+    }
+  };
+
+  const handleLoadMore = () => {
+    if (!nextCursor) return;
+    if (pageSource === 'filter') {
+      handleFilter(nextCursor);
+    } else {
+      fetchInstances(nextCursor);
     }
   };
 
@@ -197,7 +217,7 @@ const AppContent: React.FC = () => {
                   <FilterForm
                     filters={filters}
                     setFilters={setFilters}
-                    onFilter={handleFilter}
+                    onFilter={() => handleFilter()}
                     onSelectAll={handleSelectAll}
                   />
                   <InstanceTable
@@ -205,6 +225,13 @@ const AppContent: React.FC = () => {
                     selectedUuids={selectedUuids}
                     setSelectedUuids={setSelectedUuids}
                   />
+                  {nextCursor && (
+                    <div className="text-center mb-3">
+                      <Button variant="secondary" onClick={handleLoadMore}>
+                        Load more ({filteredInstances.length} of {totalInstances})
+                      </Button>
+                    </div>
+                  )}
                   <RolloutForm
                     selectedUuids={selectedUuids}
                     setParentStatus={setStatus}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+// requestForApproval stores a prepared rollout as an approval request and
+// answers 202 with it, instead of starting the rollout.
+func requestForApproval(c echo.Context, approvals *services.ApprovalService, rollout preparedRollout, opts services.RolloutOptions, submit bool, logger *log.Logger) error {
+	request, err := approvals.Create(models.ApprovalRequest{
+		Cluster:          rollout.Cluster.Name(),
+		Namespace:        rollout.Namespace,
+		Spec:             rollout.Spec,
+		Waves:            opts.Waves,
+		SuccessThreshold: opts.SuccessThreshold,
+		StartAt:          opts.StartAt,
+		Window:           opts.Window,
+		Target:           opts.Target,
+		RequestedBy:      currentUser(c),
+	}, submit)
+	if err != nil {
+		logger.Printf("Error creating approval request: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create approval request")
+	}
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"message":  "Rollout is waiting for approval by a second user",
+		"request":  request,
+		"warnings": rollout.Warnings,
+	})
+}
+
+func currentUser(c echo.Context) string {
+	username, _ := c.Get("username").(string)
+	return username
+}
+
+// createApprovalRequestHandler stores a rollout as a draft, or submits it
+// straight away when "submit" is set.
+func createApprovalRequestHandler(approvals *services.ApprovalService, checks rolloutChecks, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			rolloutRequest
+			Waves            []string `json:"waves"`
+			SuccessThreshold *float64 `json:"successThreshold"`
+			Submit           bool     `json:"submit"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding approval request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		req.Name = ""
+		prepared, err := prepareRollout(checks, req.rolloutRequest, logger)
+		if err != nil {
+			return err
+		}
+		opts, err := rolloutOptions(req.rolloutRequest, req.Waves, req.SuccessThreshold, prepared)
+		if err != nil {
+			return err
+		}
+		return requestForApproval(c, approvals, prepared, opts, req.Submit, logger)
+	}
+}
+
+func getApprovalRequestsHandler(approvals *services.ApprovalService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		requests, err := approvals.List(c.QueryParam("state"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read approval requests")
+		}
+		logger.Printf("Returning %d approval requests", len(requests))
+		return c.JSON(http.StatusOK, map[string]interface{}{"requests": requests})
+	}
+}
+
+func getApprovalRequestHandler(approvals *services.ApprovalService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		request, err := approvals.Get(c.Param("id"))
+		if err != nil {
+			return approvalError(err, logger)
+		}
+		return c.JSON(http.StatusOK, request)
+	}
+}
+
+// approvalActionHandler runs one review action (submit, approve, reject or
+// comment) as the authenticated user.
+func approvalActionHandler(action func(id, user, comment string) (models.ApprovalRequest, error), logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding approval action: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		request, err := action(c.Param("id"), currentUser(c), strings.TrimSpace(req.Comment))
+		if err != nil {
+			return approvalError(err, logger)
+		}
+		return c.JSON(http.StatusOK, request)
+	}
+}
+
+func approvalError(err error, logger *log.Logger) error {
+	switch {
+	case errors.Is(err, services.ErrApprovalNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrSelfApproval), errors.Is(err, services.ErrNotAuthor):
+		return echo.NewHTTPError(http.StatusForbidden, err.Error())
+	case errors.Is(err, services.ErrInvalidState):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidRollout), errors.Is(err, services.ErrUnknownCluster):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	logger.Printf("Error handling approval request: %v", err)
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update approval request")
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+func getFirmwareCatalogHandler(catalog *services.FirmwareCatalog, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		entries, err := catalog.List(c.QueryParam("deviceType"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read firmware catalog")
+		}
+		logger.Printf("Returning %d firmware entries", len(entries))
+		return c.JSON(http.StatusOK, map[string][]models.FirmwareEntry{"firmware": entries})
+	}
+}
+
+func getFirmwareHandler(catalog *services.FirmwareCatalog, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		entry, err := catalog.Get(c.Param("id"))
+		if err != nil {
+			return catalogError(err, logger)
+		}
+		return c.JSON(http.StatusOK, entry)
+	}
+}
+
+func createFirmwareHandler(catalog *services.FirmwareCatalog, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.FirmwareEntry
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding firmware entry: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		entry, err := catalog.Create(req)
+		if err != nil {
+			return catalogError(err, logger)
+		}
+		return c.JSON(http.StatusCreated, entry)
+	}
+}
+
+func updateFirmwareHandler(catalog *services.FirmwareCatalog, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.FirmwareEntry
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding firmware entry: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		entry, err := catalog.Update(c.Param("id"), req)
+		if err != nil {
+			return catalogError(err, logger)
+		}
+		return c.JSON(http.StatusOK, entry)
+	}
+}
+
+func deleteFirmwareHandler(catalog *services.FirmwareCatalog, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Param("id")
+		if err := catalog.Delete(id); err != nil {
+			return catalogError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Firmware " + id + " removed from catalog"})
+	}
+}
+
+func catalogError(err error, logger *log.Logger) error {
+	switch {
+	case errors.Is(err, services.ErrFirmwareNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrFirmwareExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidFirmware):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	logger.Printf("Error updating firmware catalog: %v", err)
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to update firmware catalog")
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+func getConfigurationTemplatesHandler(logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		templates := services.ConfigurationTemplates()
+		logger.Printf("Retrieved %d configuration templates", len(templates))
+		return c.JSON(http.StatusOK, map[string][]models.AkriConfigurationTemplate{"templates": templates})
+	}
+}
+
+func getAkriConfigurationsHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		configurations, err := k8sService.ListAkriConfigurations(c.QueryParam("namespace"))
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			logger.Printf("Error getting Akri configurations: %v", err)
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"configurations": []models.AkriConfiguration{},
+				"error":          "Failed to connect to Kubernetes",
+			})
+		}
+		return c.JSON(http.StatusOK, map[string][]models.AkriConfiguration{"configurations": configurations})
+	}
+}
+
+func getAkriConfigurationHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		configuration, err := k8sService.GetAkriConfiguration(c.QueryParam("namespace"), name)
+		if err != nil {
+			return configurationError(err, "Failed to get Akri configuration", logger)
+		}
+		return c.JSON(http.StatusOK, configuration)
+	}
+}
+
+func createAkriConfigurationHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.AkriConfigurationRequest
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding configuration request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		configuration, err := k8sService.CreateAkriConfiguration(req)
+		if err != nil {
+			return configurationError(err, "Failed to create Akri configuration", logger)
+		}
+		logger.Printf("Akri configuration %s created by %v", configuration.Name, c.Get("username"))
+		return c.JSON(http.StatusCreated, configuration)
+	}
+}
+
+func updateAkriConfigurationHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		var req models.AkriConfigurationRequest
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding configuration request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		configuration, err := k8sService.UpdateAkriConfiguration(c.QueryParam("namespace"), name, req)
+		if err != nil {
+			return configurationError(err, "Failed to update Akri configuration", logger)
+		}
+		logger.Printf("Akri configuration %s updated by %v", name, c.Get("username"))
+		return c.JSON(http.StatusOK, configuration)
+	}
+}
+
+func configurationError(err error, message string, logger *log.Logger) error {
+	switch {
+	case errors.Is(err, services.ErrUnknownTemplate), errors.Is(err, services.ErrInvalidConfiguration), isNamespaceError(err), apierrors.IsInvalid(err):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case apierrors.IsNotFound(err):
+		return echo.NewHTTPError(http.StatusNotFound, "Akri configuration not found")
+	case apierrors.IsAlreadyExists(err):
+		return echo.NewHTTPError(http.StatusConflict, "Akri configuration already exists")
+	case apierrors.IsConflict(err):
+		return echo.NewHTTPError(http.StatusConflict, "Akri configuration was modified concurrently, reload and retry")
+	}
+	logger.Printf("%s: %v", message, err)
+	return echo.NewHTTPError(http.StatusInternalServerError, message)
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+func getDeviceLabelsHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		all, err := groups.AllLabels()
+		if err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"labels": all})
+	}
+}
+
+// updateDeviceLabelsHandler sets and removes labels on many devices at once.
+func updateDeviceLabelsHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			UUIDs  []string          `json:"uuids"`
+			Labels map[string]string `json:"labels"`
+			Remove []string          `json:"remove"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding device labels: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		if len(req.UUIDs) == 0 || (len(req.Labels) == 0 && len(req.Remove) == 0) {
+			return echo.NewHTTPError(http.StatusBadRequest, "UUIDs and labels or remove are required")
+		}
+		updated, err := groups.UpdateLabels(req.UUIDs, req.Labels, req.Remove)
+		if err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"labels": updated})
+	}
+}
+
+func replaceDeviceLabelsHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			Labels map[string]string `json:"labels"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding device labels: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		uuid := c.Param("uuid")
+		if err := groups.ReplaceLabels(uuid, req.Labels); err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{"uuid": uuid, "labels": req.Labels})
+	}
+}
+
+func getDeviceGroupsHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := groups.ListGroups()
+		if err != nil {
+			return groupError(err, logger)
+		}
+		logger.Printf("Returning %d device groups", len(list))
+		return c.JSON(http.StatusOK, map[string][]models.DeviceGroup{"groups": list})
+	}
+}
+
+func getDeviceGroupHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		group, err := groups.GetGroup(c.Param("name"))
+		if err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+func createDeviceGroupHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.DeviceGroup
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding device group: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		group, err := groups.SaveGroup(req, false)
+		if err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusCreated, group)
+	}
+}
+
+func updateDeviceGroupHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.DeviceGroup
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding device group: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		req.Name = c.Param("name")
+		group, err := groups.SaveGroup(req, true)
+		if err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusOK, group)
+	}
+}
+
+func deleteDeviceGroupHandler(groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if err := groups.DeleteGroup(name); err != nil {
+			return groupError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Device group " + name + " deleted"})
+	}
+}
+
+// getDeviceGroupMembersHandler previews which devices of ?cluster= the group
+// currently selects, optionally narrowed further by ?selector=.
+func getDeviceGroupMembersHandler(clusters *services.ClusterRegistry, groups *services.DeviceGroups, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		target := models.RolloutTarget{Group: c.Param("name"), Selector: strings.TrimSpace(c.QueryParam("selector"))}
+		members, err := groups.Members(k8sService, target)
+		if err != nil {
+			return groupError(err, logger)
+		}
+		if members == nil {
+			members = []models.AkriInstanceDetail{}
+		}
+		logger.Printf("Device group %s has %d members on cluster %s", target.Group, len(members), k8sService.Name())
+		return c.JSON(http.StatusOK, map[string]interface{}{"cluster": k8sService.Name(), "members": members})
+	}
+}
+
+func groupError(err error, logger *log.Logger) error {
+	switch {
+	case errors.Is(err, services.ErrGroupNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrGroupExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidGroup), errors.Is(err, services.ErrInvalidLabels):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	logger.Printf("Error accessing device groups: %v", err)
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to access device groups")
+}
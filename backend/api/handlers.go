@@ -1,6 +1,8 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -13,22 +15,76 @@ import (
 	"github.com/pmavrikos/cloud-native-iot-UI/backend/auth"
 	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
 	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
-	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 )
 
-func RegisterRoutes(e *echo.Echo, authService *auth.AuthService, k8sService *services.KubernetesService, redisService *services.RedisService, logger *log.Logger) {
+func RegisterRoutes(e *echo.Echo, authService *auth.AuthService, clusters *services.ClusterRegistry, rollouts *services.RolloutService, approvals *services.ApprovalService, history *services.FirmwareHistory, catalog *services.FirmwareCatalog, registry *services.RegistryClient, verifier *services.SignatureVerifier, inventory *services.Inventory, groups *services.DeviceGroups, queries *services.SavedQueries, redisService *services.RedisService, logger *log.Logger) {
 	e.POST("/api/login", loginHandler(authService))
 	e.POST("/api/logout", logoutHandler(authService), auth.AuthMiddleware(authService))
 	e.POST("/api/change-password", changePasswordHandler(authService), auth.AuthMiddleware(authService))
+	e.POST("/api/users", createUserHandler(authService, redisService, logger), auth.AuthMiddleware(authService))
 	e.POST("/api/logs/add", addLogHandler(redisService, logger), auth.AuthMiddleware(authService))
 	e.GET("/api/validate-session", validateSessionHandler(authService), auth.AuthMiddleware(authService))
 
+	checks := rolloutChecks{clusters: clusters, groups: groups, catalog: catalog, registry: registry, verifier: verifier}
+
 	r := e.Group("")
 	r.Use(auth.AuthMiddleware(authService))
-	r.GET("/api/akri-instances", getAkriInstancesHandler(k8sService, redisService, logger))
-	r.POST("/api/filter-instances", filterInstancesHandler(k8sService, redisService, logger))
-	r.POST("/api/generate-yaml", generateYAMLHandler(k8sService, redisService, logger))
+	r.GET("/api/akri-instances", getAkriInstancesHandler(clusters, logger))
+	r.GET("/api/akri-instances/:uuid", getAkriInstanceHandler(clusters, logger))
+	r.GET("/api/inventory", getInventoryHandler(inventory, logger))
+	r.GET("/api/inventory/:uuid", getInventoryDeviceHandler(inventory, logger))
+	r.GET("/api/akri-instances/:uuid/firmware-history", getFirmwareHistoryHandler(history, logger))
+	r.GET("/api/device-labels", getDeviceLabelsHandler(groups, logger))
+	r.POST("/api/device-labels", updateDeviceLabelsHandler(groups, logger))
+	r.PUT("/api/device-labels/:uuid", replaceDeviceLabelsHandler(groups, logger))
+	r.GET("/api/device-groups", getDeviceGroupsHandler(groups, logger))
+	r.POST("/api/device-groups", createDeviceGroupHandler(groups, logger))
+	r.GET("/api/device-groups/:name", getDeviceGroupHandler(groups, logger))
+	r.PUT("/api/device-groups/:name", updateDeviceGroupHandler(groups, logger))
+	r.DELETE("/api/device-groups/:name", deleteDeviceGroupHandler(groups, logger))
+	r.GET("/api/device-groups/:name/members", getDeviceGroupMembersHandler(clusters, groups, logger))
+	r.POST("/api/filter-instances", filterInstancesHandler(clusters, queries, redisService, logger))
+	r.GET("/api/filter-instances/queries", getSavedQueriesHandler(queries, logger))
+	r.POST("/api/filter-instances/queries", createSavedQueryHandler(queries, logger))
+	r.GET("/api/filter-instances/queries/:name", getSavedQueryHandler(queries, logger))
+	r.PUT("/api/filter-instances/queries/:name", updateSavedQueryHandler(queries, logger))
+	r.DELETE("/api/filter-instances/queries/:name", deleteSavedQueryHandler(queries, logger))
+	r.POST("/api/generate-yaml", generateYAMLHandler(checks, rollouts, approvals, redisService, logger))
+	r.POST("/api/rollback", rollbackHandler(checks, approvals, history, redisService, logger))
+	r.POST("/api/flashjobs/validate", validateFlashJobHandler(checks, logger))
+	r.GET("/api/flashjobs", getFlashJobsHandler(clusters, logger))
+	r.GET("/api/flashjobs/:name", getFlashJobHandler(clusters, logger))
+	r.GET("/api/flashjobs/:name/pods", getFlashJobPodsHandler(clusters, logger))
+	r.GET("/api/flashjobs/:name/logs", getFlashJobLogsHandler(clusters, logger))
+	r.PATCH("/api/flashjobs/:name", patchFlashJobHandler(clusters, redisService, logger))
+	r.DELETE("/api/flashjobs/:name", deleteFlashJobHandler(clusters, redisService, logger))
+	r.GET("/api/rollouts", getRolloutsHandler(rollouts, logger))
+	r.POST("/api/rollouts", createRolloutHandler(rollouts, approvals, checks, logger))
+	r.GET("/api/rollouts/:id", getRolloutHandler(rollouts, logger))
+	r.POST("/api/rollouts/:id/cancel", cancelRolloutHandler(rollouts, logger))
+	r.GET("/api/approval-requests", getApprovalRequestsHandler(approvals, logger))
+	r.POST("/api/approval-requests", createApprovalRequestHandler(approvals, checks, logger))
+	r.GET("/api/approval-requests/:id", getApprovalRequestHandler(approvals, logger))
+	r.POST("/api/approval-requests/:id/submit", approvalActionHandler(approvals.Submit, logger))
+	r.POST("/api/approval-requests/:id/approve", approvalActionHandler(approvals.Approve, logger))
+	r.POST("/api/approval-requests/:id/reject", approvalActionHandler(approvals.Reject, logger))
+	r.POST("/api/approval-requests/:id/comments", approvalActionHandler(approvals.Comment, logger))
+	r.GET("/api/akri-configurations", getAkriConfigurationsHandler(clusters, logger))
+	r.GET("/api/akri-configurations/templates", getConfigurationTemplatesHandler(logger))
+	r.GET("/api/akri-configurations/:name", getAkriConfigurationHandler(clusters, logger))
+	r.POST("/api/akri-configurations", createAkriConfigurationHandler(clusters, logger))
+	r.PUT("/api/akri-configurations/:name", updateAkriConfigurationHandler(clusters, logger))
+	r.GET("/api/firmware", getFirmwareCatalogHandler(catalog, logger))
+	r.POST("/api/firmware", createFirmwareHandler(catalog, logger))
+	r.GET("/api/firmware/:id", getFirmwareHandler(catalog, logger))
+	r.PUT("/api/firmware/:id", updateFirmwareHandler(catalog, logger))
+	r.DELETE("/api/firmware/:id", deleteFirmwareHandler(catalog, logger))
+	r.GET("/api/registry/tags", getRegistryTagsHandler(registry, logger))
+	r.GET("/api/registry/resolve", resolveImageHandler(registry, logger))
 	r.GET("/api/logs", getLogsHandler(redisService, logger))
+	r.GET("/api/events", streamEventsHandler(clusters, logger))
+	r.GET("/api/clusters", getClustersHandler(clusters, logger))
 	r.GET("/api/logs/file", getFileLogsHandler(logger))
 }
 
@@ -110,6 +166,37 @@ func changePasswordHandler(authService *auth.AuthService) echo.HandlerFunc {
 	}
 }
 
+// createUserHandler lets the admin add users, such as the second user who
+// approves rollouts when REQUIRE_APPROVAL is on.
+func createUserHandler(authService *auth.AuthService, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if c.Get("username") != "admin" {
+			return echo.NewHTTPError(http.StatusForbidden, "Only admin can create users")
+		}
+		var req struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding create user request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		user, err := authService.CreateUser(strings.TrimSpace(req.Username), req.Password)
+		if err != nil {
+			return err
+		}
+		logEntry := models.LogEntry{
+			Timestamp: time.Now().Unix(),
+			Message:   fmt.Sprintf("User %s created by %v", user.Username, c.Get("username")),
+			Type:      "auth",
+		}
+		redisService.LPushList("logs", logEntry)
+		redisService.SetExpiration("logs", 48*time.Hour)
+		logger.Printf("User %s created by %v", user.Username, c.Get("username"))
+		return c.JSON(http.StatusCreated, map[string]interface{}{"id": user.ID, "username": user.Username})
+	}
+}
+
 func addLogHandler(redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var req struct {
@@ -133,23 +220,60 @@ func addLogHandler(redisService *services.RedisService, logger *log.Logger) echo
 	}
 }
 
-func getAkriInstancesHandler(k8sService *services.KubernetesService, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+// getAkriInstancesHandler lists instances a page at a time; see pageParams
+// and instancePage.
+func getAkriInstancesHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		instances, err := k8sService.GetAkriInstances()
+		page, err := pageParams(c)
+		if err != nil {
+			return err
+		}
+		instances, clusterErrors, err := clusterInstances(clusters, c.QueryParam("cluster"), namespacesParam(c))
+		if errors.Is(err, services.ErrUnknownCluster) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		if err != nil {
 			logger.Printf("Error getting Akri instances: %v", err)
-			return c.JSON(http.StatusOK, map[string]interface{}{
-				"instances": []models.AkriInstance{},
-				"error":     "Failed to connect to Kubernetes",
-			})
+			return unavailableInstances(c)
 		}
-		redisService.SetValue("akri_instances", instances)
 		logger.Printf("Retrieved %d Akri instances", len(instances))
-		return c.JSON(http.StatusOK, map[string][]models.AkriInstance{"instances": instances})
+		return instancePage(c, instances, page, clusterErrors)
+	}
+}
+
+func getAkriInstanceHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		uuid := c.Param("uuid")
+		selected, err := clusters.Select(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		for _, k8sService := range selected {
+			instance, err := k8sService.GetAkriInstance(uuid)
+			if errors.Is(err, services.ErrInstanceNotFound) {
+				continue
+			}
+			if err != nil {
+				logger.Printf("Error getting Akri instance %s from cluster %s: %v", uuid, k8sService.Name(), err)
+				if len(selected) > 1 {
+					continue
+				}
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to connect to Kubernetes")
+			}
+			return c.JSON(http.StatusOK, instance)
+		}
+		return echo.NewHTTPError(http.StatusNotFound, "Akri instance not found")
 	}
 }
 
-func filterInstancesHandler(k8sService *services.KubernetesService, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+// filterInstancesHandler filters instances by a query (see
+// services.ParseQuery), a saved query, and the per-field equality filters
+// the UI sends; whatever is given must all match. Matches are paged like
+// /api/akri-instances, with the page parameters in the body or the URL.
+func filterInstancesHandler(clusters *services.ClusterRegistry, queries *services.SavedQueries, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		var filters struct {
 			UUID           string `json:"uuid"`
@@ -157,91 +281,145 @@ func filterInstancesHandler(k8sService *services.KubernetesService, redisService
 			ApplicationType string `json:"applicationType"`
 			Status         string `json:"status"`
 			LastUpdated    string `json:"lastUpdated"`
+			Query          string   `json:"query"`
+			SavedQuery     string   `json:"savedQuery"`
+			Namespaces     []string `json:"namespaces"`
+			Cluster        string   `json:"cluster"`
+			Sort           string   `json:"sort"`
+			Cursor         string   `json:"cursor"`
+			Limit          int      `json:"limit"`
+			Fields         []string `json:"fields"`
 		}
 		if err := c.Bind(&filters); err != nil {
 			logger.Printf("Error binding filter request: %v", err)
 			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
 		}
-		instances, err := k8sService.GetAkriInstances()
+		page, err := pageParams(c)
+		if err != nil {
+			return err
+		}
+		if filters.Sort != "" {
+			page.Sort = filters.Sort
+		}
+		if filters.Cursor != "" {
+			page.Cursor = filters.Cursor
+		}
+		if filters.Limit != 0 {
+			page.Limit = filters.Limit
+		}
+		if len(filters.Fields) > 0 {
+			page.Fields = filters.Fields
+		}
+		query, err := filterQuery(queries, filters.Query, filters.SavedQuery, map[string]string{
+			"uuid":            filters.UUID,
+			"deviceType":      filters.DeviceType,
+			"applicationType": filters.ApplicationType,
+			"status":          filters.Status,
+			"lastUpdated":     filters.LastUpdated,
+		})
+		if err != nil {
+			return queryError(err, logger)
+		}
+
+		namespaces := append(namespacesParam(c), filters.Namespaces...)
+		cluster := filters.Cluster
+		if cluster == "" {
+			cluster = c.QueryParam("cluster")
+		}
+		instances, clusterErrors, err := clusterInstances(clusters, cluster, namespaces)
+		if errors.Is(err, services.ErrUnknownCluster) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		if err != nil {
 			logger.Printf("Error getting Akri instances: %v", err)
-			return c.JSON(http.StatusOK, map[string]interface{}{
-				"instances": []models.AkriInstance{},
-				"error":     "Failed to connect to Kubernetes",
-			})
+			return unavailableInstances(c)
+		}
+		for name, msg := range clusterErrors {
+			logger.Printf("Skipping instances of cluster %s: %s", name, msg)
 		}
-		filtered := k8sService.FilterInstances(instances, filters.UUID, filters.DeviceType, filters.ApplicationType, filters.Status, filters.LastUpdated)
+		k8sService, _ := clusters.Get("")
+		filtered := k8sService.FilterInstances(instances, query)
 		redisService.SetValue("filtered_instances", filtered)
 		logger.Printf("Filtered %d instances", len(filtered))
-		return c.JSON(http.StatusOK, filtered)
+		return instancePage(c, filtered, page, clusterErrors)
 	}
 }
 
-func generateYAMLHandler(k8sService *services.KubernetesService, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+func generateYAMLHandler(checks rolloutChecks, rollouts *services.RolloutService, approvals *services.ApprovalService, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		var req struct {
-			UUIDs           []string `json:"uuids"`
-			Firmware        string   `json:"firmware"`
-			FlashjobPodImage string   `json:"flashjobPodImage"`
-		}
+		var req rolloutRequest
 		if err := c.Bind(&req); err != nil {
 			logger.Printf("Error binding YAML request: %v", err)
 			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
 		}
-		if len(req.UUIDs) == 0 || req.Firmware == "" {
-			logger.Printf("Invalid YAML request: empty UUIDs or firmware")
-			return echo.NewHTTPError(http.StatusBadRequest, "UUIDs and firmware are required")
-		}
-		req.FlashjobPodImage = strings.TrimSpace(req.FlashjobPodImage)
-		if req.FlashjobPodImage == "" {
-			req.FlashjobPodImage = "harbor.nbfc.io/nubificus/iot_esp32-flashjob:local"
-		}
-
-		flashjob := map[string]interface{}{
-			"apiVersion": "application.flashjob.nbfc.io/v1alpha1",
-			"kind":       "FlashJob",
-			"metadata": map[string]interface{}{
-				"name":      "flashjob-" + req.UUIDs[0][:8],
-				"namespace": "default",
-			},
-			"spec": map[string]interface{}{
-				"applicationType":  nil,
-				"device":          nil,
-				"externalIP":      nil,
-				"firmware":        req.Firmware,
-				"flashjobPodImage": req.FlashjobPodImage,
-				"hostEndpoint":    nil,
-				"uuid":            req.UUIDs,
-				"version":         "0.2.0",
-			},
-		}
-
-		yamlData, err := yaml.Marshal(flashjob)
+		rollout, err := prepareRollout(checks, req, logger)
 		if err != nil {
-			logger.Printf("Error marshaling YAML: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate YAML")
+			return err
+		}
+
+		// A request that needs approval or is deferred becomes a single-wave
+		// rollout whose FlashJob is created once it is approved, the start
+		// time passes and the window opens.
+		if approvals.Required() || req.scheduled() {
+			opts, err := rolloutOptions(req, []string{"rest"}, nil, rollout)
+			if err != nil {
+				return err
+			}
+			if approvals.Required() {
+				return requestForApproval(c, approvals, rollout, opts, true, logger)
+			}
+			scheduled, err := rollouts.Create(rollout.Cluster, rollout.Namespace, rollout.Spec, opts)
+			if err != nil {
+				logger.Printf("Error scheduling FlashJob: %v", err)
+				return echo.NewHTTPError(http.StatusInternalServerError, "Failed to schedule FlashJob")
+			}
+			return c.JSON(http.StatusAccepted, map[string]interface{}{
+				"message":  "FlashJob scheduled",
+				"rollout":  scheduled,
+				"warnings": rollout.Warnings,
+			})
+		}
+
+		if rollout.ResourceVersion != "" {
+			err = rollout.Cluster.ReplaceFlashJob(rollout.Namespace, rollout.Name, rollout.ResourceVersion, rollout.Spec)
+		} else {
+			err = rollout.Cluster.CreateFlashJob(rollout.Namespace, rollout.Name, rollout.Spec)
+		}
+		if isNamespaceError(err) || apierrors.IsInvalid(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if apierrors.IsAlreadyExists(err) {
+			return echo.NewHTTPError(http.StatusConflict, "FlashJob "+rollout.Name+" already exists, send the resourceVersion you last saw to replace it")
+		}
+		if apierrors.IsConflict(err) {
+			return echo.NewHTTPError(http.StatusConflict, "FlashJob "+rollout.Name+" was modified concurrently, reload and retry")
+		}
+		if apierrors.IsNotFound(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "FlashJob "+rollout.Name+" not found")
+		}
+		if err != nil {
+			logger.Printf("Error creating FlashJob: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create FlashJob")
 		}
 
-		filePath := fmt.Sprintf("/app/flashjobs/flashjob-%s.yaml", req.UUIDs[0][:8])
+		// The manifest is only kept once the cluster has accepted it.
+		filePath := fmt.Sprintf("/app/flashjobs/%s.yaml", rollout.Name)
 		if err := os.MkdirAll("/app/flashjobs", 0755); err != nil {
 			logger.Printf("Error creating flashjobs directory: %v", err)
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create flashjobs directory")
 		}
-		if err := os.WriteFile(filePath, yamlData, 0644); err != nil {
+		if err := os.WriteFile(filePath, rollout.YAML, 0644); err != nil {
 			logger.Printf("Error writing YAML file: %v", err)
 			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to save YAML file")
 		}
 		logger.Printf("Saved YAML file to %s", filePath)
 
-		err = k8sService.CreateFlashJob(req.UUIDs, req.Firmware, req.FlashjobPodImage)
-		if err != nil {
-			logger.Printf("Error creating FlashJob: %v", err)
-			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create FlashJob")
-		}
-
 		logEntry := models.LogEntry{
 			Timestamp: time.Now().Unix(),
-			Message:   "FlashJob created with UUIDs: " + stringSliceToString(req.UUIDs) + " and saved to " + filePath,
+			Message:   "FlashJob " + rollout.Name + " created on cluster " + rollout.Cluster.Name() + " with UUIDs: " + stringSliceToString(rollout.Spec.UUIDs) + " and saved to " + filePath,
 			Type:      "rollout",
 		}
 		redisService.LPushList("logs", logEntry)
@@ -249,12 +427,279 @@ func generateYAMLHandler(k8sService *services.KubernetesService, redisService *s
 
 		return c.JSON(http.StatusOK, map[string]interface{}{
 			"message":      "FlashJob created successfully",
+			"name":         rollout.Name,
 			"yaml_file":    filePath,
-			"yaml_content": string(yamlData),
+			"yaml_content": string(rollout.YAML),
+			"warnings":     rollout.Warnings,
 		})
 	}
 }
 
+// validateFlashJobHandler builds the same manifest as generateYAMLHandler and
+// submits it with server-side dry run, so nothing is written to disk or
+// created in the cluster.
+func validateFlashJobHandler(checks rolloutChecks, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req rolloutRequest
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding validate request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		rollout, err := prepareRollout(checks, req, logger)
+		if err != nil {
+			return err
+		}
+
+		response := map[string]interface{}{
+			"name":         rollout.Name,
+			"namespace":    rollout.Namespace,
+			"cluster":      rollout.Cluster.Name(),
+			"yaml_content": string(rollout.YAML),
+			"warnings":     rollout.Warnings,
+			"valid":        true,
+		}
+		err = rollout.Cluster.DryRunFlashJob(rollout.Namespace, rollout.Name, rollout.ResourceVersion, rollout.Spec)
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			var status apierrors.APIStatus
+			if !errors.As(err, &status) {
+				logger.Printf("Error validating FlashJob: %v", err)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to reach Kubernetes for validation")
+			}
+			response["valid"] = false
+			response["message"] = status.Status().Message
+			response["errors"] = validationCauses(status)
+		}
+		logger.Printf("Validated FlashJob %s: valid=%v", rollout.Name, response["valid"])
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+func getFlashJobsHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		labelSelector := c.QueryParam("labelSelector")
+		fieldSelector := c.QueryParam("fieldSelector")
+		selected, err := clusters.Select(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		flashjobs := []models.FlashJob{}
+		clusterErrors := map[string]string{}
+		for _, k8sService := range selected {
+			var items []models.FlashJob
+			items, err = k8sService.ListFlashJobs(c.QueryParam("namespace"), labelSelector, fieldSelector)
+			if err != nil && len(selected) > 1 && !isNamespaceError(err) && !apierrors.IsBadRequest(err) {
+				logger.Printf("Error getting FlashJobs from cluster %s: %v", k8sService.Name(), err)
+				clusterErrors[k8sService.Name()] = err.Error()
+				err = nil
+				continue
+			}
+			if err != nil {
+				break
+			}
+			flashjobs = append(flashjobs, items...)
+		}
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if apierrors.IsBadRequest(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid label or field selector")
+		}
+		if err != nil {
+			logger.Printf("Error getting FlashJobs: %v", err)
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"flashjobs": []models.FlashJob{},
+				"error":     "Failed to connect to Kubernetes",
+			})
+		}
+		logger.Printf("Retrieved %d FlashJobs", len(flashjobs))
+		if len(clusterErrors) > 0 {
+			return c.JSON(http.StatusOK, map[string]interface{}{
+				"flashjobs":     flashjobs,
+				"clusterErrors": clusterErrors,
+			})
+		}
+		return c.JSON(http.StatusOK, map[string][]models.FlashJob{"flashjobs": flashjobs})
+	}
+}
+
+func getFlashJobHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		flashjob, err := k8sService.GetFlashJob(c.QueryParam("namespace"), name)
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if apierrors.IsNotFound(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "FlashJob not found")
+		}
+		if err != nil {
+			logger.Printf("Error getting FlashJob %s: %v", name, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get FlashJob")
+		}
+		return c.JSON(http.StatusOK, flashjob)
+	}
+}
+
+func patchFlashJobHandler(clusters *services.ClusterRegistry, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		var req struct {
+			models.FlashJobPatch
+			// Spec fields are only read to refuse them: changing what a
+			// FlashJob flashes has to pass the catalog, registry, signature
+			// and approval checks of /api/generate-yaml.
+			Firmware         *string  `json:"firmware"`
+			FlashjobPodImage *string  `json:"flashjobPodImage"`
+			UUIDs            []string `json:"uuids"`
+			Version          *string  `json:"version"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding FlashJob patch: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		if req.Firmware != nil || req.FlashjobPodImage != nil || req.UUIDs != nil || req.Version != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Only labels can be patched; re-apply FlashJob "+name+" through /api/generate-yaml to change its firmware or devices")
+		}
+		patch := req.FlashJobPatch
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		flashjob, err := k8sService.PatchFlashJob(c.QueryParam("namespace"), name, patch)
+		if apierrors.IsNotFound(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "FlashJob not found")
+		}
+		if errors.Is(err, services.ErrEmptyPatch) || isNamespaceError(err) || apierrors.IsInvalid(err) || apierrors.IsBadRequest(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			logger.Printf("Error patching FlashJob %s: %v", name, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update FlashJob")
+		}
+
+		logEntry := models.LogEntry{
+			Timestamp: time.Now().Unix(),
+			Message:   "FlashJob " + name + " updated",
+			Type:      "rollout",
+		}
+		redisService.LPushList("logs", logEntry)
+		redisService.SetExpiration("logs", 48*time.Hour)
+		return c.JSON(http.StatusOK, flashjob)
+	}
+}
+
+func deleteFlashJobHandler(clusters *services.ClusterRegistry, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		k8sService, err := clusters.Get(c.QueryParam("cluster"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		err = k8sService.DeleteFlashJob(c.QueryParam("namespace"), name)
+		if isNamespaceError(err) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if apierrors.IsNotFound(err) {
+			return echo.NewHTTPError(http.StatusNotFound, "FlashJob not found")
+		}
+		if err != nil {
+			logger.Printf("Error deleting FlashJob %s: %v", name, err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete FlashJob")
+		}
+
+		logEntry := models.LogEntry{
+			Timestamp: time.Now().Unix(),
+			Message:   "FlashJob " + name + " deleted",
+			Type:      "rollout",
+		}
+		redisService.LPushList("logs", logEntry)
+		redisService.SetExpiration("logs", 48*time.Hour)
+		return c.JSON(http.StatusOK, map[string]string{"message": "FlashJob deleted successfully"})
+	}
+}
+
+// streamEventsHandler pushes Akri instance and FlashJob changes to the client
+// as Server-Sent Events. An optional ?kinds=AkriInstance,FlashJob narrows the
+// stream; a comment line is sent periodically so proxies keep it open.
+func streamEventsHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		kinds := map[string]bool{}
+		for _, kind := range strings.Split(c.QueryParam("kinds"), ",") {
+			if kind = strings.TrimSpace(kind); kind != "" {
+				kinds[kind] = true
+			}
+		}
+
+		subscribe := clusters.Subscribe
+		if cluster := c.QueryParam("cluster"); cluster != "" && cluster != services.AllClusters {
+			k8sService, err := clusters.Get(cluster)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusNotFound, err.Error())
+			}
+			subscribe = k8sService.Subscribe
+		}
+
+		res := c.Response()
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("Connection", "keep-alive")
+		res.Header().Set("X-Accel-Buffering", "no")
+		res.WriteHeader(http.StatusOK)
+		res.Flush()
+
+		events, unsubscribe := subscribe()
+		defer unsubscribe()
+		heartbeat := time.NewTicker(30 * time.Second)
+		defer heartbeat.Stop()
+
+		logger.Printf("Event stream opened for user %v", c.Get("username"))
+		ctx := c.Request().Context()
+		for {
+			select {
+			case <-ctx.Done():
+				logger.Printf("Event stream closed for user %v", c.Get("username"))
+				return nil
+			case <-heartbeat.C:
+				if _, err := fmt.Fprint(res, ": ping\n\n"); err != nil {
+					return nil
+				}
+				res.Flush()
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				if len(kinds) > 0 && !kinds[event.Kind] {
+					continue
+				}
+				data, err := json.Marshal(event)
+				if err != nil {
+					logger.Printf("Error marshaling event: %v", err)
+					continue
+				}
+				if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event.Kind, data); err != nil {
+					return nil
+				}
+				res.Flush()
+			}
+		}
+	}
+}
+
+func getClustersHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		health := clusters.Health(3 * time.Second)
+		logger.Printf("Checked health of %d clusters", len(health))
+		return c.JSON(http.StatusOK, map[string][]models.ClusterHealth{"clusters": health})
+	}
+}
+
 func getFileLogsHandler(logger *log.Logger) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		logFilePath := "/app/logs/app.log"
@@ -293,4 +738,45 @@ func getLogsHandler(redisService *services.RedisService, logger *log.Logger) ech
 
 func stringSliceToString(slice []string) string {
 	return strings.Join(slice, ", ")
-}
\ No newline at end of file
+}
+
+// clusterInstances gathers Akri instances from the clusters selected by
+// cluster. When several clusters are queried, a failing one is reported in the
+// returned map instead of failing the whole listing.
+func clusterInstances(clusters *services.ClusterRegistry, cluster string, namespaces []string) ([]models.AkriInstance, map[string]string, error) {
+	selected, err := clusters.Select(cluster)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(selected) == 1 {
+		instances, err := selected[0].GetAkriInstances(namespaces...)
+		return instances, nil, err
+	}
+
+	instances := []models.AkriInstance{}
+	clusterErrors := map[string]string{}
+	for _, k8sService := range selected {
+		items, err := k8sService.GetAkriInstances(namespaces...)
+		if err != nil {
+			clusterErrors[k8sService.Name()] = err.Error()
+			continue
+		}
+		instances = append(instances, items...)
+	}
+	return instances, clusterErrors, nil
+}
+
+// namespacesParam reads ?namespace=a,b (or ?namespace=all) from the request.
+func namespacesParam(c echo.Context) []string {
+	var namespaces []string
+	for _, namespace := range strings.Split(c.QueryParam("namespace"), ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	return namespaces
+}
+
+func isNamespaceError(err error) bool {
+	return errors.Is(err, services.ErrNamespaceNotWatched) || errors.Is(err, services.ErrInvalidNamespace)
+}
@@ -0,0 +1,82 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+// getInventoryHandler lists inventory records. ?vanishedSince= and
+// ?seenSince= take an RFC 3339 time or a look-back such as "7d" or "36h",
+// so "vanished this week" is ?vanishedSince=7d.
+func getInventoryHandler(inventory *services.Inventory, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter := services.InventoryFilter{Cluster: c.QueryParam("cluster")}
+		if value := c.QueryParam("present"); value != "" {
+			present, err := strconv.ParseBool(value)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "present must be true or false")
+			}
+			filter.Present = &present
+		}
+		var err error
+		if filter.VanishedSince, err = parseSince(c.QueryParam("vanishedSince")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "vanishedSince: "+err.Error())
+		}
+		if filter.SeenSince, err = parseSince(c.QueryParam("seenSince")); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "seenSince: "+err.Error())
+		}
+
+		devices, err := inventory.List(filter)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read device inventory")
+		}
+		logger.Printf("Returning %d inventory records", len(devices))
+		return c.JSON(http.StatusOK, map[string]interface{}{"devices": devices})
+	}
+}
+
+func getInventoryDeviceHandler(inventory *services.Inventory, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		device, err := inventory.Get(c.Param("uuid"))
+		if errors.Is(err, services.ErrDeviceNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if err != nil {
+			logger.Printf("Error reading inventory record: %v", err)
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read device inventory")
+		}
+		return c.JSON(http.StatusOK, device)
+	}
+}
+
+// parseSince reads an RFC 3339 time, or a duration back from now in Go
+// syntax or whole days ("7d"). Empty means no bound.
+func parseSince(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Now().AddDate(0, 0, -n), nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration < 0 {
+		return time.Time{}, fmt.Errorf("%q is neither an RFC 3339 time nor a duration such as 7d or 36h", value)
+	}
+	return time.Now().Add(-duration), nil
+}
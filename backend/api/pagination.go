@@ -0,0 +1,69 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+// pageParams reads ?limit=, ?cursor=, ?sort= and ?fields=a,b from the
+// request.
+func pageParams(c echo.Context) (services.PageRequest, error) {
+	req := services.PageRequest{Sort: c.QueryParam("sort"), Cursor: c.QueryParam("cursor")}
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil {
+			return services.PageRequest{}, echo.NewHTTPError(http.StatusBadRequest, "limit must be a number")
+		}
+		req.Limit = limit
+	}
+	for _, field := range strings.Split(c.QueryParam("fields"), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			req.Fields = append(req.Fields, field)
+		}
+	}
+	return req, nil
+}
+
+// instancePage responds with one page of instances in the envelope shared
+// by every instance listing:
+//
+//	{"instances": [...], "total": 1234, "nextCursor": "...", "clusterErrors": {...}}
+//
+// nextCursor is omitted on the last page and clusterErrors when every
+// cluster answered.
+func instancePage(c echo.Context, instances []models.AkriInstance, req services.PageRequest, clusterErrors map[string]string) error {
+	page, err := services.PaginateInstances(instances, req)
+	if err == nil {
+		var selected []interface{}
+		if selected, err = services.SelectFields(page.Instances, req.Fields); err == nil {
+			response := map[string]interface{}{"instances": selected, "total": page.Total}
+			if page.NextCursor != "" {
+				response["nextCursor"] = page.NextCursor
+			}
+			if len(clusterErrors) > 0 {
+				response["clusterErrors"] = clusterErrors
+			}
+			return c.JSON(http.StatusOK, response)
+		}
+	}
+	if errors.Is(err, services.ErrInvalidPage) {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return err
+}
+
+// unavailableInstances is the envelope returned when no cluster could be
+// listed.
+func unavailableInstances(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"instances": []models.AkriInstance{},
+		"total":     0,
+		"error":     "Failed to connect to Kubernetes",
+	})
+}
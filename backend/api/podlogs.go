@@ -0,0 +1,233 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// logStream is one container whose logs are sent to the client.
+type logStream struct {
+	pod       string
+	namespace string
+	container string
+}
+
+func getFlashJobPodsHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		pods, err := flashJobPods(c, clusters, logger)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, map[string][]models.FlashJobPod{"pods": pods})
+	}
+}
+
+// getFlashJobLogsHandler streams the logs of the FlashJob's pods as plain
+// text, like kubectl logs. ?uuid= and ?pod= pick pods, ?container= one
+// container (default: all of them), ?tailLines= limits the backlog and
+// ?follow=true keeps the response open for new lines. When more than one
+// container is streamed every line is prefixed with [pod/container].
+func getFlashJobLogsHandler(clusters *services.ClusterRegistry, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var opts services.LogOptions
+		var err error
+		if value := c.QueryParam("follow"); value != "" {
+			if opts.Follow, err = strconv.ParseBool(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "follow must be true or false")
+			}
+		}
+		if value := c.QueryParam("timestamps"); value != "" {
+			if opts.Timestamps, err = strconv.ParseBool(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "timestamps must be true or false")
+			}
+		}
+		if value := c.QueryParam("tailLines"); value != "" {
+			tailLines, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || tailLines < 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "tailLines must be a non-negative number")
+			}
+			opts.TailLines = &tailLines
+		}
+
+		pods, err := flashJobPods(c, clusters, logger)
+		if err != nil {
+			return err
+		}
+		k8sService, _ := clusters.Get(c.QueryParam("cluster"))
+		podName, container := c.QueryParam("pod"), c.QueryParam("container")
+		var streams []logStream
+		for _, pod := range pods {
+			if podName != "" && pod.Name != podName {
+				continue
+			}
+			for _, name := range pod.Containers {
+				if container == "" || name == container {
+					streams = append(streams, logStream{pod: pod.Name, namespace: pod.Namespace, container: name})
+				}
+			}
+		}
+		if len(streams) == 0 {
+			return echo.NewHTTPError(http.StatusNotFound, "No matching pod or container for FlashJob "+c.Param("name"))
+		}
+
+		ctx := c.Request().Context()
+		if len(streams) == 1 {
+			// Open the only stream before answering so a failure still gets
+			// a proper status code.
+			opts.Container = streams[0].container
+			stream, err := k8sService.PodLogs(ctx, streams[0].namespace, streams[0].pod, opts)
+			if err != nil {
+				logger.Printf("Error opening FlashJob logs: %v", err)
+				return echo.NewHTTPError(http.StatusBadGateway, err.Error())
+			}
+			defer stream.Close()
+			startLogResponse(c)
+			copyLogLines(ctx, c.Response(), stream, "")
+			return nil
+		}
+
+		startLogResponse(c)
+		logger.Printf("Streaming logs of %d containers of FlashJob %s", len(streams), c.Param("name"))
+		if !opts.Follow {
+			for _, s := range streams {
+				streamLogs(ctx, k8sService, s, opts, c.Response())
+			}
+			return nil
+		}
+
+		// Following several containers: read them all at once and write
+		// their lines as they come.
+		lines := make(chan string)
+		var wg sync.WaitGroup
+		for _, s := range streams {
+			wg.Add(1)
+			go func(s logStream) {
+				defer wg.Done()
+				streamLogs(ctx, k8sService, s, opts, &lineSender{ctx: ctx, lines: lines})
+			}(s)
+		}
+		go func() {
+			wg.Wait()
+			close(lines)
+		}()
+		res := c.Response()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case line, ok := <-lines:
+				if !ok {
+					return nil
+				}
+				if _, err := io.WriteString(res, line); err != nil {
+					return nil
+				}
+				res.Flush()
+			}
+		}
+	}
+}
+
+// flashJobPods looks up the pods of the FlashJob named in the path.
+func flashJobPods(c echo.Context, clusters *services.ClusterRegistry, logger *log.Logger) ([]models.FlashJobPod, error) {
+	name := c.Param("name")
+	k8sService, err := clusters.Get(c.QueryParam("cluster"))
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	pods, err := k8sService.FlashJobPods(c.QueryParam("namespace"), name, c.QueryParam("uuid"))
+	if isNamespaceError(err) {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if apierrors.IsNotFound(err) {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "FlashJob not found")
+	}
+	if err != nil {
+		logger.Printf("Error finding pods of FlashJob %s: %v", name, err)
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, "Failed to find FlashJob pods")
+	}
+	if len(pods) == 0 {
+		return nil, echo.NewHTTPError(http.StatusNotFound, fmt.Sprintf("%s %s", services.ErrNoFlashJobPods, name))
+	}
+	return pods, nil
+}
+
+func startLogResponse(c echo.Context) {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	res.Header().Set("Cache-Control", "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.Header().Set("X-Content-Type-Options", "nosniff")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+}
+
+// streamLogs copies one container's logs to w with a [pod/container] prefix.
+// Errors are written inline since the response has already started.
+func streamLogs(ctx context.Context, k8sService *services.KubernetesService, s logStream, opts services.LogOptions, w flushWriter) {
+	prefix := "[" + s.pod + "/" + s.container + "] "
+	opts.Container = s.container
+	stream, err := k8sService.PodLogs(ctx, s.namespace, s.pod, opts)
+	if err != nil {
+		io.WriteString(w, prefix+"error: "+err.Error()+"\n")
+		w.Flush()
+		return
+	}
+	defer stream.Close()
+	copyLogLines(ctx, w, stream, prefix)
+}
+
+type flushWriter interface {
+	io.Writer
+	Flush()
+}
+
+// copyLogLines writes r to w line by line, flushing after each so the
+// browser sees lines as they are logged.
+func copyLogLines(ctx context.Context, w flushWriter, r io.Reader, prefix string) {
+	reader := bufio.NewReader(r)
+	for ctx.Err() == nil {
+		line, err := reader.ReadString('\n')
+		if line != "" {
+			if line[len(line)-1] != '\n' {
+				line += "\n"
+			}
+			if _, werr := io.WriteString(w, prefix+line); werr != nil {
+				return
+			}
+			w.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// lineSender hands each written line to the goroutine that owns the
+// response.
+type lineSender struct {
+	ctx   context.Context
+	lines chan<- string
+}
+
+func (s *lineSender) Write(p []byte) (int, error) {
+	select {
+	case s.lines <- string(p):
+		return len(p), nil
+	case <-s.ctx.Done():
+		return 0, s.ctx.Err()
+	}
+}
+
+func (s *lineSender) Flush() {}
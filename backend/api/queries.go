@@ -0,0 +1,131 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+// filterQuery combines a query, a saved query and per-field equality filters
+// (empty values ignored) into one query; all of them must match. The legacy
+// lastUpdated filter matched a prefix of the timestamp, so a value that is
+// not a full date or time, such as "2025-07", still does.
+func filterQuery(queries *services.SavedQueries, text, savedQuery string, fields map[string]string) (*services.Query, error) {
+	query, err := services.ParseQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	var saved *services.Query
+	if name := strings.TrimSpace(savedQuery); name != "" {
+		if saved, err = queries.Parse(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var terms []string
+	for field, value := range fields {
+		if value = strings.TrimSpace(value); value != "" {
+			operator := " = "
+			if field == "lastUpdated" && !isDateOrTime(value) {
+				operator = " ^= "
+			}
+			terms = append(terms, field+operator+services.QuoteQueryValue(value))
+		}
+	}
+	sort.Strings(terms)
+	equality, err := services.ParseQuery(strings.Join(terms, " AND "))
+	if err != nil {
+		return nil, err
+	}
+	return services.AndQueries(query, saved, equality), nil
+}
+
+func isDateOrTime(value string) bool {
+	if _, err := time.Parse(time.DateOnly, value); err == nil {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, value)
+	return err == nil
+}
+
+func getSavedQueriesHandler(queries *services.SavedQueries, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list, err := queries.List()
+		if err != nil {
+			return queryError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string][]models.SavedQuery{"queries": list})
+	}
+}
+
+func getSavedQueryHandler(queries *services.SavedQueries, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query, err := queries.Get(c.Param("name"))
+		if err != nil {
+			return queryError(err, logger)
+		}
+		return c.JSON(http.StatusOK, query)
+	}
+}
+
+func createSavedQueryHandler(queries *services.SavedQueries, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.SavedQuery
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding saved query: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		req.CreatedBy = currentUser(c)
+		query, err := queries.Save(req, false)
+		if err != nil {
+			return queryError(err, logger)
+		}
+		return c.JSON(http.StatusCreated, query)
+	}
+}
+
+func updateSavedQueryHandler(queries *services.SavedQueries, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req models.SavedQuery
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding saved query: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		req.Name = c.Param("name")
+		query, err := queries.Save(req, true)
+		if err != nil {
+			return queryError(err, logger)
+		}
+		return c.JSON(http.StatusOK, query)
+	}
+}
+
+func deleteSavedQueryHandler(queries *services.SavedQueries, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.Param("name")
+		if err := queries.Delete(name); err != nil {
+			return queryError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]string{"message": "Saved query " + name + " deleted"})
+	}
+}
+
+func queryError(err error, logger *log.Logger) error {
+	switch {
+	case errors.Is(err, services.ErrQueryNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrQueryExists):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidQuery):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	logger.Printf("Error accessing saved queries: %v", err)
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to access saved queries")
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+)
+
+// getRegistryTagsHandler lists the tags of the repository named by ?image=.
+func getRegistryTagsHandler(registry *services.RegistryClient, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		image := c.QueryParam("image")
+		tags, err := registry.Tags(image)
+		if err != nil {
+			return registryError(err, logger)
+		}
+		logger.Printf("Retrieved %d tags for %s", len(tags), image)
+		return c.JSON(http.StatusOK, map[string]interface{}{"image": image, "tags": tags})
+	}
+}
+
+// resolveImageHandler resolves ?image= to its digest.
+func resolveImageHandler(registry *services.RegistryClient, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		resolved, err := registry.Resolve(c.QueryParam("image"))
+		if err != nil {
+			return registryError(err, logger)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"image":     resolved,
+			"reference": resolved.String(),
+		})
+	}
+}
+
+func registryError(err error, logger *log.Logger) error {
+	switch {
+	case errors.Is(err, services.ErrInvalidReference):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrImageNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	logger.Printf("Registry lookup failed: %v", err)
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to reach the image registry")
+}
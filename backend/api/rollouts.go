@@ -0,0 +1,523 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/services"
+	"gopkg.in/yaml.v3"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const defaultFlashjobPodImage = "harbor.nbfc.io/nubificus/iot_esp32-flashjob:local"
+
+// rolloutRequest is the body shared by every endpoint that starts or previews
+// a rollout.
+type rolloutRequest struct {
+	UUIDs []string `json:"uuids"`
+	// Group and Selector target devices instead of UUIDs; see
+	// models.RolloutTarget.
+	Group    string `json:"group"`
+	Selector string `json:"selector"`
+	// FirmwareID picks a catalog entry. Firmware, with Version when the
+	// image has several, is accepted instead but must also be in the catalog.
+	FirmwareID       string  `json:"firmwareId"`
+	Firmware         string  `json:"firmware"`
+	Version          string  `json:"version"`
+	FlashjobPodImage string  `json:"flashjobPodImage"`
+	Namespace        string  `json:"namespace"`
+	Cluster          string  `json:"cluster"`
+	Name             string  `json:"name"`
+	Device           *string `json:"device"`
+	ApplicationType  *string `json:"applicationType"`
+	ExternalIP       *string `json:"externalIP"`
+	HostEndpoint     *string `json:"hostEndpoint"`
+	// StartAt and Window defer the rollout; see services.RolloutOptions.
+	StartAt string                    `json:"startAt"`
+	Window  *models.MaintenanceWindow `json:"window"`
+
+	// ResourceVersion, with Name, replaces that existing FlashJob provided
+	// it is still at this version.
+	ResourceVersion string `json:"resourceVersion"`
+
+	// image, set by rollbacks, is the exact image to flash again: the
+	// catalog entry's image, pinned to the digest it had back then.
+	image string
+}
+
+// scheduled reports whether the request defers the rollout instead of
+// creating its FlashJob right away.
+func (req rolloutRequest) scheduled() bool {
+	return strings.TrimSpace(req.StartAt) != "" || req.Window != nil
+}
+
+// rolloutChecks are the services every rollout request is checked against
+// before anything is created.
+type rolloutChecks struct {
+	clusters *services.ClusterRegistry
+	groups   *services.DeviceGroups
+	catalog  *services.FirmwareCatalog
+	registry *services.RegistryClient
+	verifier *services.SignatureVerifier
+}
+
+// preparedRollout is a FlashJob ready to be submitted to Cluster.
+type preparedRollout struct {
+	Cluster   *services.KubernetesService
+	Name      string
+	Namespace string
+	Spec      models.FlashJobSpec
+	// Target is set when the devices were picked by group or selector, so
+	// deferred rollouts can pick them again when they start.
+	Target   *models.RolloutTarget
+	Warnings []string
+	YAML     []byte
+
+	// ResourceVersion is set when an existing FlashJob is replaced.
+	ResourceVersion string
+}
+
+// prepareRollout validates req, picks its firmware from the catalog, pins
+// its images to the digests the registry reports, checks the firmware
+// signature, resolves its target devices and renders the FlashJob manifest.
+// Errors are returned as *echo.HTTPError.
+func prepareRollout(checks rolloutChecks, req rolloutRequest, logger *log.Logger) (preparedRollout, error) {
+	req.FirmwareID = strings.TrimSpace(req.FirmwareID)
+	req.Firmware = strings.TrimSpace(req.Firmware)
+	req.Group = strings.TrimSpace(req.Group)
+	req.Selector = strings.TrimSpace(req.Selector)
+	targeted := req.Group != "" || req.Selector != ""
+	if (len(req.UUIDs) == 0 && !targeted) || (req.Firmware == "" && req.FirmwareID == "") {
+		logger.Printf("Invalid YAML request: empty UUIDs or firmware")
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "UUIDs (or a group or selector) and firmware are required")
+	}
+	if len(req.UUIDs) > 0 && targeted {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "Give either UUIDs or a group or selector, not both")
+	}
+	var firmware models.FirmwareEntry
+	var err error
+	if req.FirmwareID != "" {
+		firmware, err = checks.catalog.Get(req.FirmwareID)
+	} else {
+		firmware, err = checks.catalog.FindByImage(req.Firmware, strings.TrimSpace(req.Version))
+	}
+	if errors.Is(err, services.ErrFirmwareNotFound) || errors.Is(err, services.ErrInvalidFirmware) {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		logger.Printf("Error reading firmware catalog: %v", err)
+		return preparedRollout{}, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read firmware catalog")
+	}
+	req.FlashjobPodImage = strings.TrimSpace(req.FlashjobPodImage)
+	if req.FlashjobPodImage == "" {
+		req.FlashjobPodImage = defaultFlashjobPodImage
+	}
+	firmwareImage, podImage := firmware.Image, req.FlashjobPodImage
+	if req.image != "" {
+		firmwareImage = req.image
+	}
+	if checks.registry.Verifies() {
+		if firmwareImage, err = resolveImage(checks.registry, "firmware", firmwareImage, logger); err != nil {
+			return preparedRollout{}, err
+		}
+		if podImage, err = resolveImage(checks.registry, "flashjobPodImage", podImage, logger); err != nil {
+			return preparedRollout{}, err
+		}
+	}
+	if checks.verifier.Required() {
+		verified, err := checks.verifier.Verify(firmwareImage)
+		switch {
+		case errors.Is(err, services.ErrUnsignedFirmware), errors.Is(err, services.ErrInvalidSignature),
+			errors.Is(err, services.ErrInvalidReference), errors.Is(err, services.ErrImageNotFound):
+			return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "Firmware refused: "+err.Error())
+		case err != nil:
+			logger.Printf("Error verifying signature of %s: %v", firmwareImage, err)
+			return preparedRollout{}, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to verify firmware signature")
+		}
+		firmwareImage = verified
+	}
+	// The catalog checksum is the manifest digest: a resolved image must
+	// match it and any other is pinned to it, so the runtime pulls nothing
+	// else.
+	if firmwareImage, err = services.PinChecksum(firmware, firmwareImage); err != nil {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "Firmware refused: "+err.Error())
+	}
+
+	k8sService, err := checks.clusters.Get(strings.TrimSpace(req.Cluster))
+	if err != nil {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusNotFound, err.Error())
+	}
+	namespace, err := k8sService.RolloutNamespaceFor(req.Namespace)
+	if err != nil {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	var target *models.RolloutTarget
+	var incompatible string
+	if targeted {
+		target = &models.RolloutTarget{
+			Group:            req.Group,
+			Selector:         req.Selector,
+			Device:           req.Device,
+			ApplicationType:  req.ApplicationType,
+			ExternalIP:       req.ExternalIP,
+			HostEndpoint:     req.HostEndpoint,
+			DeviceTypes:      firmware.DeviceTypes,
+			ApplicationTypes: firmware.ApplicationTypes,
+		}
+		members, err := checks.groups.Members(k8sService, *target)
+		if errors.Is(err, services.ErrGroupNotFound) || errors.Is(err, services.ErrInvalidGroup) {
+			return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+		if err != nil {
+			logger.Printf("Error resolving device group: %v", err)
+			return preparedRollout{}, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to resolve target devices")
+		}
+		if len(members) == 0 {
+			return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "The group or selector matches no devices")
+		}
+		// Members the firmware does not support are skipped, as they are
+		// when a deferred rollout resolves its target.
+		req.UUIDs = services.CompatibleMembers(*target, members)
+		if len(req.UUIDs) == 0 {
+			return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("None of the %d devices the group or selector matches is compatible with the firmware", len(members)))
+		}
+		if skipped := len(members) - len(req.UUIDs); skipped > 0 {
+			incompatible = fmt.Sprintf("%d of %d target devices skipped: the firmware does not support their DEVICE or APPLICATION_TYPE", skipped, len(members))
+		}
+	}
+
+	spec := models.FlashJobSpec{
+		UUIDs:            req.UUIDs,
+		Firmware:         firmwareImage,
+		FlashjobPodImage: podImage,
+		Version:          firmware.Version,
+		Device:           req.Device,
+		ApplicationType:  req.ApplicationType,
+		ExternalIP:       req.ExternalIP,
+		HostEndpoint:     req.HostEndpoint,
+	}
+	warnings, err := k8sService.ResolveFlashJobSpec(&spec)
+	if errors.Is(err, services.ErrUnknownUUIDs) || errors.Is(err, services.ErrConflictingTargets) {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		logger.Printf("Error resolving FlashJob targets: %v", err)
+		return preparedRollout{}, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to resolve target devices")
+	}
+	if incompatible != "" {
+		warnings = append(warnings, incompatible)
+	}
+	for _, warning := range warnings {
+		logger.Printf("FlashJob for UUIDs %v: %s", req.UUIDs, warning)
+	}
+
+	instances, err := k8sService.GetAkriInstances()
+	if err != nil {
+		logger.Printf("Error listing target devices: %v", err)
+		return preparedRollout{}, echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to resolve target devices")
+	}
+	var targets []models.AkriInstance
+	for _, instance := range instances {
+		if containsUUID(req.UUIDs, instance.UUID) {
+			targets = append(targets, instance)
+		}
+	}
+	if err := services.CheckCompatibility(firmware, targets); err != nil {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	// A caller-supplied name with the resourceVersion last seen re-applies
+	// that FlashJob; otherwise every rollout gets a fresh name.
+	name := strings.TrimSpace(req.Name)
+	req.ResourceVersion = strings.TrimSpace(req.ResourceVersion)
+	if req.ResourceVersion != "" && name == "" {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "resourceVersion needs the name of the FlashJob to replace")
+	}
+	if name == "" {
+		name = services.NewFlashJobName(req.UUIDs)
+	} else if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return preparedRollout{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid FlashJob name: "+strings.Join(errs, ", "))
+	}
+
+	yamlData, err := yaml.Marshal(services.FlashJobManifest(name, namespace, spec))
+	if err != nil {
+		logger.Printf("Error marshaling YAML: %v", err)
+		return preparedRollout{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to generate YAML")
+	}
+	return preparedRollout{
+		Cluster:         k8sService,
+		Name:            name,
+		Namespace:       namespace,
+		ResourceVersion: req.ResourceVersion,
+		Spec:            spec,
+		Target:          target,
+		Warnings:        warnings,
+		YAML:            yamlData,
+	}, nil
+}
+
+// resolveImage returns ref pinned to its digest, or an *echo.HTTPError naming
+// field when the registry does not have it.
+func resolveImage(registry *services.RegistryClient, field, ref string, logger *log.Logger) (string, error) {
+	resolved, err := registry.Resolve(ref)
+	if errors.Is(err, services.ErrInvalidReference) || errors.Is(err, services.ErrImageNotFound) {
+		return "", echo.NewHTTPError(http.StatusBadRequest, field+": "+err.Error())
+	}
+	if err != nil {
+		logger.Printf("Error resolving %s %s: %v", field, ref, err)
+		return "", echo.NewHTTPError(http.StatusServiceUnavailable, field+": failed to reach the image registry")
+	}
+	logger.Printf("Resolved %s %s to %s", field, ref, resolved.Digest)
+	return resolved.String(), nil
+}
+
+func containsUUID(uuids []string, uuid string) bool {
+	for _, u := range uuids {
+		if u == uuid {
+			return true
+		}
+	}
+	return false
+}
+
+// validationCauses flattens the field errors the API server attached to a
+// rejected request.
+func validationCauses(status apierrors.APIStatus) []map[string]string {
+	causes := []map[string]string{}
+	details := status.Status().Details
+	if details == nil {
+		return causes
+	}
+	for _, cause := range details.Causes {
+		causes = append(causes, map[string]string{
+			"field":   cause.Field,
+			"message": cause.Message,
+			"reason":  string(cause.Type),
+		})
+	}
+	return causes
+}
+
+// rolloutOptions builds and validates the staging options of a request.
+// Requests without waves run as a single wave.
+func rolloutOptions(req rolloutRequest, waves []string, threshold *float64, prepared preparedRollout) (services.RolloutOptions, error) {
+	opts := services.RolloutOptions{
+		Target:           prepared.Target,
+		Waves:            waves,
+		SuccessThreshold: services.DefaultSuccessThreshold,
+		StartAt:          strings.TrimSpace(req.StartAt),
+		Window:           req.Window,
+	}
+	if threshold != nil {
+		opts.SuccessThreshold = *threshold
+	}
+	if _, err := services.ValidateRolloutOptions(prepared.Spec.UUIDs, opts); err != nil {
+		return services.RolloutOptions{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return opts, nil
+}
+
+func createRolloutHandler(rollouts *services.RolloutService, approvals *services.ApprovalService, checks rolloutChecks, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			rolloutRequest
+			Waves            []string `json:"waves"`
+			SuccessThreshold *float64 `json:"successThreshold"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding rollout request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		// Every wave gets its own FlashJob name.
+		req.Name = ""
+		prepared, err := prepareRollout(checks, req.rolloutRequest, logger)
+		if err != nil {
+			return err
+		}
+		opts, err := rolloutOptions(req.rolloutRequest, req.Waves, req.SuccessThreshold, prepared)
+		if err != nil {
+			return err
+		}
+		if approvals.Required() {
+			return requestForApproval(c, approvals, prepared, opts, true, logger)
+		}
+
+		rollout, err := rollouts.Create(prepared.Cluster, prepared.Namespace, prepared.Spec, opts)
+		if err != nil {
+			logger.Printf("Error creating rollout: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create rollout")
+		}
+		return c.JSON(http.StatusCreated, map[string]interface{}{
+			"rollout":  rollout,
+			"warnings": prepared.Warnings,
+		})
+	}
+}
+
+func getRolloutsHandler(rollouts *services.RolloutService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		list := rollouts.List()
+		logger.Printf("Returning %d rollouts", len(list))
+		return c.JSON(http.StatusOK, map[string]interface{}{"rollouts": list})
+	}
+}
+
+func getRolloutHandler(rollouts *services.RolloutService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rollout, err := rollouts.Get(c.Param("id"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		return c.JSON(http.StatusOK, rollout)
+	}
+}
+
+func cancelRolloutHandler(rollouts *services.RolloutService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rollout, err := rollouts.Cancel(c.Param("id"))
+		if errors.Is(err, services.ErrRolloutNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+		if errors.Is(err, services.ErrRolloutFinished) {
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		}
+		if err != nil {
+			logger.Printf("Error cancelling rollout: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to cancel rollout")
+		}
+		return c.JSON(http.StatusOK, rollout)
+	}
+}
+
+func getFirmwareHistoryHandler(history *services.FirmwareHistory, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		uuid := c.Param("uuid")
+		records, err := history.History(uuid)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read firmware history")
+		}
+		logger.Printf("Returning %d firmware records for %s", len(records), uuid)
+		return c.JSON(http.StatusOK, map[string]interface{}{"uuid": uuid, "history": records})
+	}
+}
+
+// rollbackHandler restores every selected device to the firmware it ran
+// before its latest successful flash (see FirmwareHistory.Previous). Devices
+// that were on different firmware are grouped, one FlashJob per previous
+// image, and each FlashJob is marked as a rollback. When approval is
+// required each group becomes an approval request instead.
+func rollbackHandler(checks rolloutChecks, approvals *services.ApprovalService, history *services.FirmwareHistory, redisService *services.RedisService, logger *log.Logger) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req struct {
+			UUIDs     []string `json:"uuids"`
+			Cluster   string   `json:"cluster"`
+			Namespace string   `json:"namespace"`
+		}
+		if err := c.Bind(&req); err != nil {
+			logger.Printf("Error binding rollback request: %v", err)
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request")
+		}
+		if len(req.UUIDs) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "UUIDs are required")
+		}
+
+		var order []string
+		groups := map[string]*rolloutRequest{}
+		skipped := map[string]string{}
+		for _, uuid := range req.UUIDs {
+			previous, ok, err := history.Previous(uuid)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to read firmware history")
+			}
+			if !ok {
+				skipped[uuid] = "no earlier firmware recorded"
+				continue
+			}
+			key := previous.Firmware + "\x00" + previous.FlashjobPodImage + "\x00" + previous.Version
+			if _, exists := groups[key]; !exists {
+				order = append(order, key)
+				groups[key] = &rolloutRequest{
+					Firmware:         previous.Firmware,
+					FlashjobPodImage: previous.FlashjobPodImage,
+					Version:          previous.Version,
+					Cluster:          req.Cluster,
+					Namespace:        req.Namespace,
+					image:            previous.Firmware,
+				}
+			}
+			groups[key].UUIDs = append(groups[key].UUIDs, uuid)
+		}
+		if len(order) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "None of the selected devices has an earlier firmware to roll back to")
+		}
+
+		// Earlier firmware passes the same catalog, registry, signature and
+		// compatibility checks as a new rollout before anything is created.
+		var warnings []string
+		prepared := make([]preparedRollout, 0, len(order))
+		for _, key := range order {
+			rollout, err := prepareRollout(checks, *groups[key], logger)
+			if err != nil {
+				return err
+			}
+			rollout.Spec.Rollback = true
+			warnings = append(warnings, rollout.Warnings...)
+			prepared = append(prepared, rollout)
+		}
+
+		flashjobs := make([]map[string]interface{}, 0, len(prepared))
+		for _, rollout := range prepared {
+			spec, k8sService := rollout.Spec, rollout.Cluster
+			result := map[string]interface{}{
+				"name":     rollout.Name,
+				"uuids":    spec.UUIDs,
+				"firmware": spec.Firmware,
+				"version":  spec.Version,
+			}
+			if approvals.Required() {
+				delete(result, "name")
+				request, err := approvals.Create(models.ApprovalRequest{
+					Cluster:          k8sService.Name(),
+					Namespace:        rollout.Namespace,
+					Spec:             spec,
+					SuccessThreshold: services.DefaultSuccessThreshold,
+					RequestedBy:      currentUser(c),
+				}, true)
+				if err != nil {
+					logger.Printf("Error creating rollback approval request: %v", err)
+					result["error"] = err.Error()
+				} else {
+					result["request"] = request.ID
+				}
+				flashjobs = append(flashjobs, result)
+				continue
+			}
+			if err := k8sService.CreateFlashJob(rollout.Namespace, rollout.Name, spec); err != nil {
+				logger.Printf("Error creating rollback FlashJob: %v", err)
+				result["error"] = err.Error()
+				flashjobs = append(flashjobs, result)
+				continue
+			}
+			redisService.LPushList("logs", models.LogEntry{
+				Timestamp: time.Now().Unix(),
+				Message:   "Rollback FlashJob " + rollout.Name + " created on cluster " + k8sService.Name() + " restoring " + spec.Firmware + " for UUIDs: " + strings.Join(spec.UUIDs, ", "),
+				Type:      "rollout",
+			})
+			redisService.SetExpiration("logs", 48*time.Hour)
+			flashjobs = append(flashjobs, result)
+		}
+		return c.JSON(http.StatusOK, map[string]interface{}{
+			"flashjobs": flashjobs,
+			"skipped":   skipped,
+			"warnings":  warnings,
+		})
+	}
+}
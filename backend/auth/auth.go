@@ -186,6 +186,56 @@ func (s *AuthService) ChangePassword(userID int, newPassword string) error {
 	return errors.New("user not found")
 }
 
+// CreateUser adds a login, so that rollouts can be approved by a second
+// user. Usernames take letters, digits, '.', '_' and '-'; an existing user
+// is never overwritten.
+func (s *AuthService) CreateUser(username, password string) (User, error) {
+	if err := validateInput(username); err != nil {
+		return User{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if strings.IndexFunc(username, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-')
+	}) >= 0 {
+		return User{}, echo.NewHTTPError(http.StatusBadRequest, "username may only contain letters, digits, '.', '_' and '-'")
+	}
+	if err := validateInput(password); err != nil {
+		return User{}, echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	ctx := context.Background()
+	// IDs continue after the seeded admin, which is user 1.
+	if err := s.redisClient.SetNX(ctx, "users:next-id", 1, 0).Err(); err != nil {
+		log.Printf("Error initializing user IDs: %v", err)
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user")
+	}
+	id, err := s.redisClient.Incr(ctx, "users:next-id").Result()
+	if err != nil {
+		log.Printf("Error allocating user ID: %v", err)
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Printf("Error generating password hash: %v", err)
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user")
+	}
+	user := User{ID: int(id), Username: username, PasswordHash: string(hash)}
+	userData, err := json.Marshal(user)
+	if err != nil {
+		log.Printf("Error marshaling user data: %v", err)
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user")
+	}
+	created, err := s.redisClient.SetNX(ctx, "user:"+username, userData, 0).Result()
+	if err != nil {
+		log.Printf("Error storing user in Redis: %v", err)
+		return User{}, echo.NewHTTPError(http.StatusInternalServerError, "Failed to create user")
+	}
+	if !created {
+		return User{}, echo.NewHTTPError(http.StatusConflict, "User "+username+" already exists")
+	}
+	log.Printf("Created user: %s", username)
+	return user, nil
+}
+
 func AuthMiddleware(authService *AuthService) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
@@ -1,8 +1,12 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
@@ -12,16 +16,63 @@ type Config struct {
 	RedisDB        int
 	KubeConfigPath string
 	JWTSecret      string
+	// AkriNamespaces lists the namespaces Akri instances are read from; empty
+	// (AKRI_NAMESPACES=all) watches every namespace.
+	AkriNamespaces    []string
+	FlashJobNamespace string
+	// ClusterName names the cluster reached through KubeConfigPath or the
+	// in-cluster config; ClustersFile optionally lists further clusters.
+	ClusterName  string
+	ClustersFile string
+	// RequireApproval holds every rollout until a second user approves it.
+	// It is on by default; the admin adds approvers through POST /api/users.
+	RequireApproval bool
+	// RegistryVerify checks firmware and pod images against their registry
+	// before a FlashJob is created. RegistryAuthFile is a .dockerconfigjson,
+	// typically mounted from a kubernetes.io/dockerconfigjson Secret. Only
+	// the registries in it, RegistryInsecureHosts and RegistryAllowedHosts
+	// are ever contacted.
+	RegistryVerify        bool
+	RegistryAuthFile      string
+	RegistryInsecureHosts []string
+	RegistryAllowedHosts  []string
+	// FirmwareSignatureVerify refuses rollouts of firmware without a valid
+	// signature by one of the PEM public keys in FirmwareTrustedKeys. It is
+	// off by default; once on, the backend does not start without keys.
+	FirmwareSignatureVerify bool
+	FirmwareTrustedKeys     string
+}
+
+// ClusterConfig describes one extra cluster from the clusters file.
+type ClusterConfig struct {
+	Name              string   `yaml:"name"`
+	KubeConfig        string   `yaml:"kubeconfig"`
+	Context           string   `yaml:"context"`
+	APIServer         string   `yaml:"apiServer"`
+	Insecure          bool     `yaml:"insecure"`
+	AkriNamespaces    []string `yaml:"akriNamespaces"`
+	FlashJobNamespace string   `yaml:"flashJobNamespace"`
 }
 
 func LoadConfig() Config {
 	return Config{
-		ServerAddr:     getEnv("SERVER_ADDR", "0.0.0.0:8000"),
-		RedisHost:      getEnv("REDIS_HOST", "localhost"),
-		RedisPort:      getEnvAsInt("REDIS_PORT", 6379),
-		RedisDB:        getEnvAsInt("REDIS_DB", 0),
-		KubeConfigPath: getEnv("KUBE_CONFIG_PATH", "/root/.kube/config"),
-		JWTSecret:      getEnv("JWT_SECRET", "mysecretkey"),
+		ServerAddr:              getEnv("SERVER_ADDR", "0.0.0.0:8000"),
+		RedisHost:               getEnv("REDIS_HOST", "localhost"),
+		RedisPort:               getEnvAsInt("REDIS_PORT", 6379),
+		RedisDB:                 getEnvAsInt("REDIS_DB", 0),
+		KubeConfigPath:          getEnv("KUBE_CONFIG_PATH", "/root/.kube/config"),
+		JWTSecret:               getEnv("JWT_SECRET", "mysecretkey"),
+		AkriNamespaces:          getEnvAsNamespaces("AKRI_NAMESPACES", []string{"default"}),
+		FlashJobNamespace:       getEnv("FLASHJOB_NAMESPACE", "default"),
+		ClusterName:             getEnv("CLUSTER_NAME", "default"),
+		ClustersFile:            getEnv("CLUSTERS_FILE", ""),
+		RequireApproval:         getEnvAsBool("REQUIRE_APPROVAL", true),
+		RegistryVerify:          getEnvAsBool("REGISTRY_VERIFY", false),
+		RegistryAuthFile:        getEnv("REGISTRY_AUTH_FILE", ""),
+		RegistryInsecureHosts:   getEnvAsList("REGISTRY_INSECURE_HOSTS"),
+		RegistryAllowedHosts:    getEnvAsList("REGISTRY_ALLOWED_HOSTS"),
+		FirmwareSignatureVerify: getEnvAsBool("FIRMWARE_SIGNATURE_VERIFY", false),
+		FirmwareTrustedKeys:     getEnv("FIRMWARE_TRUSTED_KEYS", "/app/keys"),
 	}
 }
 
@@ -40,3 +91,80 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value, exists := os.LookupEnv(key); exists {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsList(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getEnvAsNamespaces(key string, defaultValue []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultValue
+	}
+	var namespaces []string
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "all" || namespace == "*" {
+			return nil
+		}
+		if namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		return defaultValue
+	}
+	return namespaces
+}
+
+// LoadClusters reads the clusters file, a YAML document of the form
+//
+//	clusters:
+//	  - name: plant-3
+//	    kubeconfig: /etc/clusters/plant-3.yaml
+//	    akriNamespaces: [akri]
+func LoadClusters(path string) ([]ClusterConfig, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file struct {
+		Clusters []ClusterConfig `yaml:"clusters"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for i, cluster := range file.Clusters {
+		if cluster.Name == "" || cluster.KubeConfig == "" {
+			return nil, fmt.Errorf("cluster %d in %s needs a name and a kubeconfig", i, path)
+		}
+		if len(cluster.AkriNamespaces) == 0 {
+			file.Clusters[i].AkriNamespaces = []string{"default"}
+		}
+		for _, namespace := range cluster.AkriNamespaces {
+			if namespace == "all" || namespace == "*" {
+				file.Clusters[i].AkriNamespaces = nil
+				break
+			}
+		}
+	}
+	return file.Clusters, nil
+}
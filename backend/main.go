@@ -9,6 +9,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 
@@ -49,6 +50,7 @@ func main() {
 
 	// Initialize Kubernetes client
 	var k8sClient dynamic.Interface
+	var k8sTyped kubernetes.Interface
 	apiServerOverride := os.Getenv("KUBERNETES_API_SERVER")
 	kubeConfigPath := os.Getenv("KUBE_CONFIG_PATH")
 	
@@ -71,43 +73,17 @@ func main() {
 	if err != nil || fileInfo.IsDir() {
 		logger.Printf("Kubeconfig not available: %v", err)
 	} else {
-		logger.Printf("Loading kubeconfig from %s", kubeConfigPath)
-		
-		
-		config, err := clientcmd.LoadFromFile(kubeConfigPath)
+		insecure, _ := strconv.ParseBool(os.Getenv("KUBERNETES_INSECURE"))
+		k8sClient, k8sTyped, err = newClusterClient(config.ClusterConfig{
+			Name:       cfg.ClusterName,
+			KubeConfig: kubeConfigPath,
+			APIServer:  apiServerOverride,
+			Insecure:   insecure,
+		}, logger)
 		if err != nil {
-			logger.Printf("Error loading kubeconfig: %v", err)
+			logger.Printf("Failed to create Kubernetes client: %v", err)
 		} else {
-			
-			if apiServerOverride != "" {
-				for _, cluster := range config.Clusters {
-					cluster.Server = apiServerOverride
-				}
-				logger.Printf("Overriding Kubernetes API server to: %s", apiServerOverride)
-			}
-			
-			
-			clientConfig := clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{})
-			k8sConfig, err := clientConfig.ClientConfig()
-			if err != nil {
-				logger.Printf("Error creating client config: %v", err)
-			} else {
-				
-				insecure, _ := strconv.ParseBool(os.Getenv("KUBERNETES_INSECURE"))
-				if insecure {
-					logger.Println("Skipping TLS verification for Kubernetes API")
-					k8sConfig.TLSClientConfig.Insecure = true
-					k8sConfig.TLSClientConfig.CAData = nil
-					k8sConfig.TLSClientConfig.CAFile = ""
-				}
-				
-				k8sClient, err = dynamic.NewForConfig(k8sConfig)
-				if err != nil {
-					logger.Printf("Failed to create Kubernetes client: %v", err)
-				} else {
-					logger.Println("Kubernetes client initialized successfully")
-				}
-			}
+			logger.Println("Kubernetes client initialized successfully")
 		}
 	}
 
@@ -119,6 +95,9 @@ func main() {
 			logger.Printf("In-cluster config failed: %v", err)
 		} else {
 			k8sClient, err = dynamic.NewForConfig(k8sConfig)
+			if err == nil {
+				k8sTyped, err = kubernetes.NewForConfig(k8sConfig)
+			}
 			if err != nil {
 				logger.Printf("Failed to create in-cluster client: %v", err)
 			} else {
@@ -134,28 +113,115 @@ func main() {
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:     []string{"http://0.0.0.0:5173"},
 		AllowCredentials: true,
-		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.DELETE},
+		AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.PATCH, echo.DELETE},
 		AllowHeaders:     []string{echo.HeaderAuthorization, echo.HeaderContentType},
 	}))
 
+	// Build the cluster registry: the local cluster first, then any clusters
+	// listed in the clusters file
+	clusterConfigs, err := config.LoadClusters(cfg.ClustersFile)
+	if err != nil {
+		logger.Fatal("Failed to load clusters file:", err)
+	}
+	redisService := services.NewRedisService(redisClient, logger)
+	history := services.NewFirmwareHistory(redisService, logger)
+	clusters := services.NewClusterRegistry(logger)
+	if k8sClient != nil || len(clusterConfigs) == 0 {
+		clusters.Register(services.NewKubernetesService(cfg.ClusterName, k8sClient, k8sTyped, cfg.AkriNamespaces, cfg.FlashJobNamespace, history, logger))
+	}
+	for _, clusterConfig := range clusterConfigs {
+		client, typed, err := newClusterClient(clusterConfig, logger)
+		if err != nil {
+			logger.Printf("Failed to create client for cluster %s: %v", clusterConfig.Name, err)
+		}
+		if err := clusters.Register(services.NewKubernetesService(clusterConfig.Name, client, typed, clusterConfig.AkriNamespaces, clusterConfig.FlashJobNamespace, history, logger)); err != nil {
+			logger.Printf("Skipping cluster %s: %v", clusterConfig.Name, err)
+		}
+	}
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	clusters.Start(stopCh)
+
 	// Healthcheck endpoint
 	e.GET("/health", func(c echo.Context) error {
+		health := clusters.CacheHealth()
 		status := "healthy"
-		if k8sClient == nil {
+		for _, cluster := range health {
+			if cluster.Status != "healthy" {
+				status = "degraded"
+			}
+		}
+		if k8sClient == nil && len(clusterConfigs) == 0 {
 			status = "degraded (no k8s connection)"
 		}
-		return c.JSON(200, map[string]string{"status": status})
+		return c.JSON(200, map[string]interface{}{"status": status, "clusters": health})
 	})
 
 	// Initialize services
 	authService := auth.NewAuthService(redisClient, cfg.JWTSecret)
-	k8sService := services.NewKubernetesService(k8sClient, logger)
-	redisService := services.NewRedisService(redisClient, logger)
+	catalog := services.NewFirmwareCatalog(redisService, logger)
+	registry, err := services.NewRegistryClient(cfg.RegistryVerify, cfg.RegistryAuthFile, cfg.RegistryInsecureHosts, cfg.RegistryAllowedHosts, logger)
+	if err != nil {
+		logger.Fatal("Failed to load registry credentials:", err)
+	}
+	verifier, err := services.NewSignatureVerifier(cfg.FirmwareSignatureVerify, cfg.FirmwareTrustedKeys, registry, redisService, logger)
+	if err != nil {
+		logger.Fatal("Failed to load trusted firmware keys:", err)
+	}
+	inventory := services.NewInventory(clusters, redisService, logger)
+	inventory.Start(stopCh)
+	groups := services.NewDeviceGroups(redisService, logger)
+	queries := services.NewSavedQueries(redisService, logger)
+	rollouts := services.NewRolloutService(clusters, groups, redisService, logger)
+	rollouts.Start(stopCh)
+	approvals := services.NewApprovalService(cfg.RequireApproval, clusters, rollouts, redisService, logger)
 
 	// Register routes
-	api.RegisterRoutes(e, authService, k8sService, redisService, logger)
+	api.RegisterRoutes(e, authService, clusters, rollouts, approvals, history, catalog, registry, verifier, inventory, groups, queries, redisService, logger)
 
 	// Start server
 	logger.Printf("Starting server on %s", cfg.ServerAddr)
 	e.Logger.Fatal(e.Start(cfg.ServerAddr))
 }
+
+// newClusterClient builds, from a kubeconfig file, the dynamic client used
+// for custom resources and the typed client used for core APIs such as pod
+// logs, applying the optional context, API server and TLS overrides of the
+// cluster entry.
+func newClusterClient(cluster config.ClusterConfig, logger *log.Logger) (dynamic.Interface, kubernetes.Interface, error) {
+	logger.Printf("Loading kubeconfig for cluster %s from %s", cluster.Name, cluster.KubeConfig)
+	kubeConfig, err := clientcmd.LoadFromFile(cluster.KubeConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cluster.APIServer != "" {
+		for _, c := range kubeConfig.Clusters {
+			c.Server = cluster.APIServer
+		}
+		logger.Printf("Overriding Kubernetes API server for cluster %s to: %s", cluster.Name, cluster.APIServer)
+	}
+
+	clientConfig := clientcmd.NewDefaultClientConfig(*kubeConfig, &clientcmd.ConfigOverrides{CurrentContext: cluster.Context})
+	k8sConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cluster.Insecure {
+		logger.Printf("Skipping TLS verification for cluster %s", cluster.Name)
+		k8sConfig.TLSClientConfig.Insecure = true
+		k8sConfig.TLSClientConfig.CAData = nil
+		k8sConfig.TLSClientConfig.CAFile = ""
+	}
+
+	client, err := dynamic.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	typed, err := kubernetes.NewForConfig(k8sConfig)
+	if err != nil {
+		return nil, nil, err
+	}
+	return client, typed, nil
+}
@@ -2,14 +2,377 @@ package models
 
 type AkriInstance struct {
 	UUID           string `json:"uuid"`
+	Namespace      string `json:"namespace"`
+	Cluster        string `json:"cluster"`
 	DeviceType     string `json:"deviceType"`
 	ApplicationType string `json:"applicationType"`
 	Status         string `json:"status"`
 	LastUpdated    string `json:"lastUpdated"`
+	BrokerProperties map[string]string `json:"brokerProperties"`
+	// CurrentFirmware and CurrentVersion are what the device runs, as far as
+	// is known; FirmwareSource says where that came from.
+	CurrentFirmware string `json:"currentFirmware"`
+	CurrentVersion  string `json:"currentVersion"`
+	FirmwareSource  string `json:"firmwareSource,omitempty"`
 }
 
+// AkriInstance.FirmwareSource values.
+const (
+	FirmwareFromProperties  = "brokerProperties"
+	FirmwareFromAnnotations = "annotations"
+	FirmwareFromFlashJob    = "flashjob"
+)
+
 type LogEntry struct {
 	Timestamp int64  `json:"timestamp"`
 	Message   string `json:"message"`
 	Type      string `json:"type"`
-}
\ No newline at end of file
+}
+
+type FlashJob struct {
+	Name             string         `json:"name"`
+	Namespace        string         `json:"namespace"`
+	Cluster          string         `json:"cluster"`
+	UUIDs            []string       `json:"uuids"`
+	Firmware         string         `json:"firmware"`
+	FlashjobPodImage string         `json:"flashjobPodImage"`
+	Version          string         `json:"version"`
+	CreatedAt        string         `json:"createdAt"`
+	Rollback         bool           `json:"rollback,omitempty"`
+	Status           FlashJobStatus `json:"status"`
+}
+
+type FlashJobStatus struct {
+	Phase   string         `json:"phase"`
+	Message string         `json:"message,omitempty"`
+	Devices []DeviceStatus `json:"devices"`
+}
+
+type DeviceStatus struct {
+	UUID  string `json:"uuid"`
+	Phase string `json:"phase"`
+	Error string `json:"error,omitempty"`
+}
+
+// FlashJobPatch is the part of a FlashJob that can be changed in place.
+// Firmware and devices only change through a new rollout, which is checked
+// and, when required, approved.
+type FlashJobPatch struct {
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+type WatchEvent struct {
+	Type      string      `json:"type"`
+	Kind      string      `json:"kind"`
+	Cluster   string      `json:"cluster"`
+	Object    interface{} `json:"object"`
+	Timestamp int64       `json:"timestamp"`
+}
+
+type ClusterHealth struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Device states derived for an Akri instance, in order of precedence.
+const (
+	StatusFlashing    = "flashing"
+	StatusUnreachable = "unreachable"
+	StatusOrphaned    = "orphaned"
+	StatusBusy        = "busy"
+	StatusActive      = "active"
+)
+
+type AkriInstanceDetail struct {
+	AkriInstance
+	Name              string            `json:"name"`
+	ConfigurationName string            `json:"configurationName"`
+	Nodes             []string          `json:"nodes"`
+	Shared            bool              `json:"shared"`
+	DeviceUsage       map[string]string `json:"deviceUsage"`
+	BrokerPods        []BrokerPod       `json:"brokerPods"`
+}
+
+type BrokerPod struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Phase     string `json:"phase"`
+	NodeName  string `json:"nodeName"`
+	Ready     bool   `json:"ready"`
+	StartTime string `json:"startTime,omitempty"`
+}
+
+// FlashJobPod is a pod the operator started for a FlashJob. UUIDs are the
+// FlashJob's devices the pod works on, as far as the pod tells.
+type FlashJobPod struct {
+	Name       string   `json:"name"`
+	Namespace  string   `json:"namespace"`
+	Phase      string   `json:"phase"`
+	NodeName   string   `json:"nodeName"`
+	StartTime  string   `json:"startTime,omitempty"`
+	UUIDs      []string `json:"uuids"`
+	Containers []string `json:"containers"`
+}
+
+type AkriConfiguration struct {
+	Name             string            `json:"name"`
+	Namespace        string            `json:"namespace"`
+	Cluster          string            `json:"cluster"`
+	DiscoveryHandler DiscoveryHandler  `json:"discoveryHandler"`
+	BrokerProperties map[string]string `json:"brokerProperties"`
+	Capacity         int64             `json:"capacity"`
+	HasBroker        bool              `json:"hasBroker"`
+	CreatedAt        string            `json:"createdAt"`
+	InstanceCount    int               `json:"instanceCount"`
+	ResourceVersion  string            `json:"resourceVersion"`
+}
+
+type DiscoveryHandler struct {
+	Name             string `json:"name"`
+	DiscoveryDetails string `json:"discoveryDetails"`
+}
+
+type AkriConfigurationDetail struct {
+	AkriConfiguration
+	Instances []AkriInstance `json:"instances"`
+}
+
+// AkriConfigurationRequest creates or edits a Configuration. On create, unset
+// fields are taken from Template.
+type AkriConfigurationRequest struct {
+	Name             string            `json:"name"`
+	Namespace        string            `json:"namespace"`
+	Template         string            `json:"template"`
+	DiscoveryHandler *DiscoveryHandler `json:"discoveryHandler"`
+	BrokerProperties map[string]string `json:"brokerProperties"`
+	Capacity         *int64            `json:"capacity"`
+	ResourceVersion  string            `json:"resourceVersion"`
+}
+
+type AkriConfigurationTemplate struct {
+	Name             string            `json:"name"`
+	Description      string            `json:"description"`
+	DiscoveryHandler DiscoveryHandler  `json:"discoveryHandler"`
+	BrokerProperties map[string]string `json:"brokerProperties"`
+	Capacity         int64             `json:"capacity"`
+}
+
+// FlashJobSpec is the spec of a FlashJob CR. The pointer fields stay null in
+// the manifest when they could not be resolved.
+type FlashJobSpec struct {
+	UUIDs            []string `json:"uuids"`
+	Firmware         string   `json:"firmware"`
+	FlashjobPodImage string   `json:"flashjobPodImage"`
+	Version          string   `json:"version"`
+	Device           *string  `json:"device"`
+	ApplicationType  *string  `json:"applicationType"`
+	ExternalIP       *string  `json:"externalIP"`
+	HostEndpoint     *string  `json:"hostEndpoint"`
+	// Rollback marks a FlashJob that restores earlier firmware.
+	Rollback bool `json:"rollback,omitempty"`
+}
+
+// Rollout phases.
+const (
+	RolloutScheduled = "Scheduled"
+	RolloutRunning   = "Running"
+	RolloutSucceeded = "Succeeded"
+	RolloutHalted    = "Halted"
+	RolloutCancelled = "Cancelled"
+)
+
+// Rollout flashes its devices in waves, one FlashJob per wave. The next wave
+// only starts once the share of devices that succeeded in the current one
+// reaches SuccessThreshold.
+type Rollout struct {
+	ID               string             `json:"id"`
+	Cluster          string             `json:"cluster"`
+	Namespace        string             `json:"namespace"`
+	Spec             FlashJobSpec       `json:"spec"`
+	Waves            []RolloutWave      `json:"waves"`
+	SuccessThreshold float64            `json:"successThreshold"`
+	StartAt          string             `json:"startAt,omitempty"`
+	Window           *MaintenanceWindow `json:"window,omitempty"`
+	NextWindowAt     string             `json:"nextWindowAt,omitempty"`
+	Target           *RolloutTarget     `json:"target,omitempty"`
+	Stages           []string           `json:"stages,omitempty"`
+	CurrentWave      int                `json:"currentWave"`
+	Phase            string             `json:"phase"`
+	Message          string             `json:"message,omitempty"`
+	CreatedAt        string             `json:"createdAt"`
+	UpdatedAt        string             `json:"updatedAt"`
+}
+
+// MaintenanceWindow opens at every activation of Cron, evaluated in
+// Timezone, and stays open for Duration (a Go duration such as "6h").
+type MaintenanceWindow struct {
+	Cron     string `json:"cron"`
+	Duration string `json:"duration"`
+	Timezone string `json:"timezone"`
+}
+
+type RolloutWave struct {
+	UUIDs      []string `json:"uuids"`
+	FlashJob   string   `json:"flashJob,omitempty"`
+	Phase      string   `json:"phase"`
+	Succeeded  int      `json:"succeeded"`
+	Failed     int      `json:"failed"`
+	StartedAt  string   `json:"startedAt,omitempty"`
+	FinishedAt string   `json:"finishedAt,omitempty"`
+}
+
+// FirmwareRecord is one FlashJob that flashed a device, as kept in its
+// firmware history. Succeeded marks a record written once the FlashJob had
+// flashed the device, FlashJobCreatedAt is when that FlashJob was created
+// and Rollback that it restored earlier firmware.
+type FirmwareRecord struct {
+	Firmware          string `json:"firmware"`
+	FlashjobPodImage  string `json:"flashjobPodImage"`
+	Version           string `json:"version"`
+	FlashJob          string `json:"flashJob"`
+	FlashJobCreatedAt string `json:"flashJobCreatedAt,omitempty"`
+	Cluster           string `json:"cluster"`
+	Namespace         string `json:"namespace"`
+	Succeeded         bool   `json:"succeeded,omitempty"`
+	Rollback          bool   `json:"rollback,omitempty"`
+	Timestamp         int64  `json:"timestamp"`
+}
+
+// Approval request states. A request moves draft -> pending_approval ->
+// approved -> executing -> done, or from pending_approval to rejected.
+const (
+	RequestDraft           = "draft"
+	RequestPendingApproval = "pending_approval"
+	RequestApproved        = "approved"
+	RequestExecuting       = "executing"
+	RequestDone            = "done"
+	RequestRejected        = "rejected"
+)
+
+// ApprovalRequest is a rollout waiting for a second user's sign-off. Once
+// approved it is executed as a Rollout of exactly Spec.UUIDs; Target only
+// shows the group or selector they were picked from.
+type ApprovalRequest struct {
+	ID               string             `json:"id"`
+	State            string             `json:"state"`
+	Cluster          string             `json:"cluster"`
+	Namespace        string             `json:"namespace"`
+	Spec             FlashJobSpec       `json:"spec"`
+	Waves            []string           `json:"waves,omitempty"`
+	SuccessThreshold float64            `json:"successThreshold"`
+	StartAt          string             `json:"startAt,omitempty"`
+	Window           *MaintenanceWindow `json:"window,omitempty"`
+	Target           *RolloutTarget     `json:"target,omitempty"`
+	RequestedBy      string             `json:"requestedBy"`
+	ReviewedBy       string             `json:"reviewedBy,omitempty"`
+	RolloutID        string             `json:"rolloutId,omitempty"`
+	Events           []ApprovalEvent    `json:"events"`
+	CreatedAt        string             `json:"createdAt"`
+	UpdatedAt        string             `json:"updatedAt"`
+}
+
+// ApprovalEvent records one action on an approval request, with the
+// comment the user left.
+type ApprovalEvent struct {
+	User      string `json:"user"`
+	Action    string `json:"action"`
+	Comment   string `json:"comment,omitempty"`
+	Timestamp string `json:"timestamp"`
+}
+
+// FirmwareEntry is one vetted firmware image in the catalog. DeviceTypes
+// must name at least one DEVICE; empty ApplicationTypes place no
+// restriction on APPLICATION_TYPE. Checksum is the digest of the image
+// manifest, which rollouts pin the firmware to.
+type FirmwareEntry struct {
+	ID               string   `json:"id"`
+	Image            string   `json:"image"`
+	Version          string   `json:"version"`
+	DeviceTypes      []string `json:"deviceTypes"`
+	ApplicationTypes []string `json:"applicationTypes"`
+	ReleaseNotes     string   `json:"releaseNotes"`
+	Checksum         string   `json:"checksum"`
+	CreatedAt        string   `json:"createdAt"`
+	UpdatedAt        string   `json:"updatedAt"`
+}
+
+// InventoryDevice is the persistent record of a device UUID, kept after the
+// Akri instance disappears.
+type InventoryDevice struct {
+	UUID             string            `json:"uuid"`
+	Cluster          string            `json:"cluster"`
+	Namespace        string            `json:"namespace"`
+	Name             string            `json:"name"`
+	DeviceType       string            `json:"deviceType"`
+	ApplicationType  string            `json:"applicationType"`
+	BrokerProperties map[string]string `json:"brokerProperties"`
+	CurrentFirmware  string            `json:"currentFirmware"`
+	CurrentVersion   string            `json:"currentVersion"`
+	FirmwareSource   string            `json:"firmwareSource,omitempty"`
+	Present          bool              `json:"present"`
+	FirstSeen        string            `json:"firstSeen"`
+	LastSeen         string            `json:"lastSeen"`
+	VanishedAt       string            `json:"vanishedAt,omitempty"`
+	Events           []InventoryEvent  `json:"events"`
+}
+
+// Inventory event types.
+const (
+	InventoryAppeared          = "appeared"
+	InventoryVanished          = "vanished"
+	InventoryReappeared        = "reappeared"
+	InventoryPropertiesChanged = "properties_changed"
+	InventoryFirmwareChanged   = "firmware_changed"
+)
+
+type InventoryEvent struct {
+	Type      string                    `json:"type"`
+	Timestamp string                    `json:"timestamp"`
+	Changes   map[string]PropertyChange `json:"changes,omitempty"`
+}
+
+// PropertyChange is one brokerProperties key, or for firmware_changed events
+// currentFirmware or currentVersion, whose value changed; an empty Old or
+// New means the key was added or removed.
+type PropertyChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+// DeviceGroup is a named set of devices: the listed UUIDs plus every device
+// matching Selector, a label selector over the device's labels and
+// brokerProperties. Membership is evaluated each time the group is used.
+type DeviceGroup struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Selector    string   `json:"selector"`
+	UUIDs       []string `json:"uuids"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+// RolloutTarget selects a rollout's devices when it starts rather than when
+// it is requested. With both set, the group's members are narrowed by
+// Selector. The remaining fields carry what the FlashJob spec must hold for
+// each member to stay eligible.
+type RolloutTarget struct {
+	Group            string   `json:"group,omitempty"`
+	Selector         string   `json:"selector,omitempty"`
+	Device           *string  `json:"device,omitempty"`
+	ApplicationType  *string  `json:"applicationType,omitempty"`
+	ExternalIP       *string  `json:"externalIP,omitempty"`
+	HostEndpoint     *string  `json:"hostEndpoint,omitempty"`
+	DeviceTypes      []string `json:"deviceTypes,omitempty"`
+	ApplicationTypes []string `json:"applicationTypes,omitempty"`
+}
+
+// SavedQuery is a named FilterInstances query; see services.ParseQuery.
+type SavedQuery struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Query       string `json:"query"`
+	CreatedBy   string `json:"createdBy"`
+	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
+}
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+var (
+	ErrApprovalNotFound = errors.New("approval request not found")
+	ErrInvalidState     = errors.New("approval request is not in a state that allows this")
+	ErrSelfApproval     = errors.New("approval requests must be reviewed by a different user")
+	ErrNotAuthor        = errors.New("only the author of an approval request can do this")
+)
+
+// approvalsKey is the Redis hash holding every approval request as JSON,
+// keyed by ID.
+const approvalsKey = "approval-requests"
+
+// ApprovalService keeps rollouts from starting until a second user approves
+// them. Requests live in Redis only, so every instance sees the same state.
+type ApprovalService struct {
+	mu       sync.Mutex
+	required bool
+	clusters *ClusterRegistry
+	rollouts *RolloutService
+	redis    *RedisService
+	logger   *log.Logger
+}
+
+func NewApprovalService(required bool, clusters *ClusterRegistry, rollouts *RolloutService, redis *RedisService, logger *log.Logger) *ApprovalService {
+	return &ApprovalService{
+		required: required,
+		clusters: clusters,
+		rollouts: rollouts,
+		redis:    redis,
+		logger:   logger,
+	}
+}
+
+// Required reports whether rollouts must go through approval.
+func (s *ApprovalService) Required() bool {
+	return s.required
+}
+
+// Create stores request as a draft, or submits it for approval right away
+// when submit is set.
+func (s *ApprovalService) Create(request models.ApprovalRequest, submit bool) (models.ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC().Format(time.RFC3339)
+	request.ID = "request-" + utilrand.String(8)
+	request.State = models.RequestDraft
+	request.CreatedAt = now
+	request.Events = []models.ApprovalEvent{{User: request.RequestedBy, Action: "created", Timestamp: now}}
+	if submit {
+		request.State = models.RequestPendingApproval
+		request.Events = append(request.Events, models.ApprovalEvent{User: request.RequestedBy, Action: "submitted", Timestamp: now})
+	}
+	if err := s.save(&request); err != nil {
+		return models.ApprovalRequest{}, err
+	}
+	s.audit(request, request.RequestedBy, "created")
+	return request, nil
+}
+
+// List returns the requests in state, or every request when state is empty,
+// newest first.
+func (s *ApprovalService) List(state string) ([]models.ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values, err := s.redis.HGetAllValues(approvalsKey)
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]models.ApprovalRequest, 0, len(values))
+	for id, value := range values {
+		var request models.ApprovalRequest
+		if err := json.Unmarshal([]byte(value), &request); err != nil {
+			s.logger.Printf("Skipping unreadable approval request %s: %v", id, err)
+			continue
+		}
+		s.refresh(&request)
+		if state == "" || request.State == state {
+			requests = append(requests, request)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt > requests[j].CreatedAt
+	})
+	return requests, nil
+}
+
+func (s *ApprovalService) Get(id string) (models.ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, err := s.load(id)
+	if err != nil {
+		return models.ApprovalRequest{}, err
+	}
+	s.refresh(&request)
+	return request, nil
+}
+
+// Submit moves a draft to pending approval. Only its author may submit it.
+func (s *ApprovalService) Submit(id, user, comment string) (models.ApprovalRequest, error) {
+	return s.transition(id, user, "submitted", comment, func(request *models.ApprovalRequest) error {
+		if request.State != models.RequestDraft {
+			return fmt.Errorf("%w: %s is %s", ErrInvalidState, id, request.State)
+		}
+		if request.RequestedBy != user {
+			return fmt.Errorf("%w: only %s can submit %s", ErrNotAuthor, request.RequestedBy, id)
+		}
+		request.State = models.RequestPendingApproval
+		return nil
+	})
+}
+
+// Approve signs off a pending request and starts its rollout. The approver
+// must not be the user who requested it.
+func (s *ApprovalService) Approve(id, user, comment string) (models.ApprovalRequest, error) {
+	return s.transition(id, user, "approved", comment, func(request *models.ApprovalRequest) error {
+		if request.State != models.RequestPendingApproval {
+			return fmt.Errorf("%w: %s is %s", ErrInvalidState, id, request.State)
+		}
+		if request.RequestedBy == user {
+			return ErrSelfApproval
+		}
+		request.State = models.RequestApproved
+		request.ReviewedBy = user
+		return s.execute(request)
+	})
+}
+
+func (s *ApprovalService) Reject(id, user, comment string) (models.ApprovalRequest, error) {
+	return s.transition(id, user, "rejected", comment, func(request *models.ApprovalRequest) error {
+		if request.State != models.RequestPendingApproval {
+			return fmt.Errorf("%w: %s is %s", ErrInvalidState, id, request.State)
+		}
+		if request.RequestedBy == user {
+			return ErrSelfApproval
+		}
+		request.State = models.RequestRejected
+		request.ReviewedBy = user
+		return nil
+	})
+}
+
+// Comment adds a comment without changing the request's state.
+func (s *ApprovalService) Comment(id, user, comment string) (models.ApprovalRequest, error) {
+	return s.transition(id, user, "commented", comment, func(*models.ApprovalRequest) error {
+		return nil
+	})
+}
+
+// transition loads the request, applies change and, when it succeeds,
+// records the action and saves the request.
+func (s *ApprovalService) transition(id, user, action, comment string, change func(*models.ApprovalRequest) error) (models.ApprovalRequest, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	request, err := s.load(id)
+	if err != nil {
+		return models.ApprovalRequest{}, err
+	}
+	s.refresh(&request)
+	if err := change(&request); err != nil {
+		return models.ApprovalRequest{}, err
+	}
+	request.Events = append(request.Events, models.ApprovalEvent{
+		User:      user,
+		Action:    action,
+		Comment:   comment,
+		Timestamp: time.Now().UTC().Format(time.RFC3339),
+	})
+	if err := s.save(&request); err != nil {
+		return models.ApprovalRequest{}, err
+	}
+	s.audit(request, user, action)
+	return request, nil
+}
+
+// execute hands an approved request to the rollout orchestrator. If the
+// rollout cannot be created the approval fails and the request stays
+// pending. The rollout flashes exactly the UUIDs that were approved; its
+// target is not resolved again.
+func (s *ApprovalService) execute(request *models.ApprovalRequest) error {
+	cluster, err := s.clusters.Get(request.Cluster)
+	if err != nil {
+		return err
+	}
+	waves := request.Waves
+	if len(waves) == 0 {
+		waves = []string{"rest"}
+	}
+	rollout, err := s.rollouts.Create(cluster, request.Namespace, request.Spec, RolloutOptions{
+		Waves:            waves,
+		SuccessThreshold: request.SuccessThreshold,
+		StartAt:          request.StartAt,
+		Window:           request.Window,
+	})
+	if err != nil {
+		return err
+	}
+	request.State = models.RequestExecuting
+	request.RolloutID = rollout.ID
+	return nil
+}
+
+// refresh marks an executing request done once its rollout has finished.
+func (s *ApprovalService) refresh(request *models.ApprovalRequest) {
+	if request.State != models.RequestExecuting {
+		return
+	}
+	rollout, err := s.rollouts.Get(request.RolloutID)
+	if err != nil || active(&rollout) {
+		return
+	}
+	request.State = models.RequestDone
+	s.save(request)
+}
+
+func (s *ApprovalService) load(id string) (models.ApprovalRequest, error) {
+	var request models.ApprovalRequest
+	found, err := s.redis.HGetValue(approvalsKey, id, &request)
+	if err != nil {
+		return models.ApprovalRequest{}, err
+	}
+	if !found {
+		return models.ApprovalRequest{}, fmt.Errorf("%w: %s", ErrApprovalNotFound, id)
+	}
+	return request, nil
+}
+
+func (s *ApprovalService) save(request *models.ApprovalRequest) error {
+	request.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	return s.redis.HSetValue(approvalsKey, request.ID, request)
+}
+
+func (s *ApprovalService) audit(request models.ApprovalRequest, user, action string) {
+	message := fmt.Sprintf("Approval request %s %s by %s (state %s)", request.ID, action, user, request.State)
+	s.logger.Println(message)
+	s.redis.LPushList("logs", models.LogEntry{
+		Timestamp: time.Now().Unix(),
+		Message:   message,
+		Type:      "approval",
+	})
+	s.redis.SetExpiration("logs", 48*time.Hour)
+}
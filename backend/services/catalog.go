@@ -0,0 +1,255 @@
+package services
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+var (
+	ErrFirmwareNotFound     = errors.New("firmware not found in catalog")
+	ErrFirmwareExists       = errors.New("firmware image and version already in catalog")
+	ErrInvalidFirmware      = errors.New("invalid firmware entry")
+	ErrIncompatibleFirmware = errors.New("firmware is not compatible with the target devices")
+	ErrChecksumMismatch     = errors.New("firmware image does not match its catalog checksum")
+)
+
+// firmwareCatalogKey is the Redis hash holding every catalog entry as JSON,
+// keyed by ID.
+const firmwareCatalogKey = "firmware-catalog"
+
+// checksumLengths are the accepted checksum algorithms with the length of
+// their hex digest. A checksum is the digest of the image manifest, as the
+// registry reports it.
+var checksumLengths = map[string]int{
+	"sha256": 64,
+	"sha512": 128,
+}
+
+// FirmwareCatalog stores the firmware images rollouts may use.
+type FirmwareCatalog struct {
+	mu     sync.Mutex
+	redis  *RedisService
+	logger *log.Logger
+}
+
+func NewFirmwareCatalog(redis *RedisService, logger *log.Logger) *FirmwareCatalog {
+	return &FirmwareCatalog{redis: redis, logger: logger}
+}
+
+// List returns the catalog sorted by image and version. A non-empty
+// deviceType keeps only the entries compatible with it.
+func (c *FirmwareCatalog) List(deviceType string) ([]models.FirmwareEntry, error) {
+	values, err := c.redis.HGetAllValues(firmwareCatalogKey)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]models.FirmwareEntry, 0, len(values))
+	for id, value := range values {
+		var entry models.FirmwareEntry
+		if err := json.Unmarshal([]byte(value), &entry); err != nil {
+			c.logger.Printf("Skipping unreadable firmware entry %s: %v", id, err)
+			continue
+		}
+		if deviceType != "" && !supportsDevice(entry.DeviceTypes, deviceType) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Image != entries[j].Image {
+			return entries[i].Image < entries[j].Image
+		}
+		return entries[i].Version < entries[j].Version
+	})
+	return entries, nil
+}
+
+func (c *FirmwareCatalog) Get(id string) (models.FirmwareEntry, error) {
+	var entry models.FirmwareEntry
+	found, err := c.redis.HGetValue(firmwareCatalogKey, id, &entry)
+	if err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	if !found {
+		return models.FirmwareEntry{}, fmt.Errorf("%w: %s", ErrFirmwareNotFound, id)
+	}
+	return entry, nil
+}
+
+// FindByImage returns the entry for image, which may be pinned to a digest.
+// When several versions share the image, version picks one and must be
+// given.
+func (c *FirmwareCatalog) FindByImage(image, version string) (models.FirmwareEntry, error) {
+	entries, err := c.List("")
+	if err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	var matches []models.FirmwareEntry
+	for _, entry := range entries {
+		if SameImage(entry.Image, image) && (version == "" || entry.Version == version) {
+			matches = append(matches, entry)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return models.FirmwareEntry{}, fmt.Errorf("%w: %s", ErrFirmwareNotFound, image)
+	case 1:
+		return matches[0], nil
+	}
+	return models.FirmwareEntry{}, fmt.Errorf("%w: %s has %d versions in the catalog, pick one by firmwareId", ErrInvalidFirmware, image, len(matches))
+}
+
+func (c *FirmwareCatalog) Create(entry models.FirmwareEntry) (models.FirmwareEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry.ID = "fw-" + utilrand.String(8)
+	if err := c.validate(&entry); err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	entry.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	entry.UpdatedAt = entry.CreatedAt
+	if err := c.redis.HSetValue(firmwareCatalogKey, entry.ID, entry); err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	c.logger.Printf("Added firmware %s %s to catalog as %s", entry.Image, entry.Version, entry.ID)
+	return entry, nil
+}
+
+func (c *FirmwareCatalog) Update(id string, entry models.FirmwareEntry) (models.FirmwareEntry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	existing, err := c.Get(id)
+	if err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	entry.ID = id
+	if err := c.validate(&entry); err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	entry.CreatedAt = existing.CreatedAt
+	entry.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := c.redis.HSetValue(firmwareCatalogKey, id, entry); err != nil {
+		return models.FirmwareEntry{}, err
+	}
+	c.logger.Printf("Updated firmware %s in catalog", id)
+	return entry, nil
+}
+
+func (c *FirmwareCatalog) Delete(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, err := c.Get(id); err != nil {
+		return err
+	}
+	if err := c.redis.HDelete(firmwareCatalogKey, id); err != nil {
+		return err
+	}
+	c.logger.Printf("Removed firmware %s from catalog", id)
+	return nil
+}
+
+// validate normalises entry and checks it, including that no other entry
+// has the same image and version. Callers hold c.mu.
+func (c *FirmwareCatalog) validate(entry *models.FirmwareEntry) error {
+	entry.Image = strings.TrimSpace(entry.Image)
+	entry.Version = strings.TrimSpace(entry.Version)
+	entry.Checksum = strings.ToLower(strings.TrimSpace(entry.Checksum))
+	entry.DeviceTypes = trimmedValues(entry.DeviceTypes)
+	entry.ApplicationTypes = trimmedValues(entry.ApplicationTypes)
+	if entry.Image == "" || entry.Version == "" {
+		return fmt.Errorf("%w: image and version are required", ErrInvalidFirmware)
+	}
+	if len(entry.DeviceTypes) == 0 {
+		return fmt.Errorf("%w: at least one device type is required", ErrInvalidFirmware)
+	}
+	algorithm, digest, _ := strings.Cut(entry.Checksum, ":")
+	length, ok := checksumLengths[algorithm]
+	if _, err := hex.DecodeString(digest); !ok || err != nil || len(digest) != length {
+		return fmt.Errorf("%w: checksum must be sha256:<64 hex digits> or sha512:<128 hex digits>", ErrInvalidFirmware)
+	}
+
+	entries, err := c.List("")
+	if err != nil {
+		return err
+	}
+	for _, other := range entries {
+		if other.ID != entry.ID && other.Image == entry.Image && other.Version == entry.Version {
+			return fmt.Errorf("%w: %s %s is %s", ErrFirmwareExists, entry.Image, entry.Version, other.ID)
+		}
+	}
+	return nil
+}
+
+// CheckCompatibility rejects entry when any target instance's DEVICE or
+// APPLICATION_TYPE is not one the entry supports. Instances without the
+// property are rejected too, since compatibility cannot be shown, and so is
+// every instance when an older entry lists no device types.
+func CheckCompatibility(entry models.FirmwareEntry, targets []models.AkriInstance) error {
+	var problems []string
+	for _, instance := range targets {
+		if !supportsDevice(entry.DeviceTypes, instance.DeviceType) {
+			problems = append(problems, fmt.Sprintf("%s has DEVICE %q", instance.UUID, instance.DeviceType))
+		}
+		if len(entry.ApplicationTypes) > 0 && !allows(entry.ApplicationTypes, instance.ApplicationType) {
+			problems = append(problems, fmt.Sprintf("%s has APPLICATION_TYPE %q", instance.UUID, instance.ApplicationType))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s %s supports DEVICE %v and APPLICATION_TYPE %v, but %s",
+			ErrIncompatibleFirmware, entry.Image, entry.Version, entry.DeviceTypes, entry.ApplicationTypes, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// PinChecksum returns image pinned to entry's checksum. An image already
+// pinned, because the registry resolved it, must carry that digest.
+func PinChecksum(entry models.FirmwareEntry, image string) (string, error) {
+	image = strings.TrimSpace(image)
+	if _, digest, pinned := strings.Cut(image, "@"); pinned {
+		if !strings.EqualFold(digest, entry.Checksum) {
+			return "", fmt.Errorf("%w: %s resolved to %s, the catalog expects %s", ErrChecksumMismatch, withoutDigest(image), digest, entry.Checksum)
+		}
+		return image, nil
+	}
+	return image + "@" + entry.Checksum, nil
+}
+
+// supportsDevice reports whether deviceType is in supported, ignoring case.
+// Unlike allows, an empty list supports nothing.
+func supportsDevice(supported []string, deviceType string) bool {
+	return len(supported) > 0 && allows(supported, deviceType)
+}
+
+// allows reports whether value is in supported, ignoring case. An empty list
+// allows everything.
+func allows(supported []string, value string) bool {
+	if len(supported) == 0 {
+		return true
+	}
+	for _, s := range supported {
+		if strings.EqualFold(s, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func trimmedValues(values []string) []string {
+	trimmed := make([]string, 0, len(values))
+	for _, value := range values {
+		if value = strings.TrimSpace(value); value != "" {
+			trimmed = append(trimmed, value)
+		}
+	}
+	return trimmed
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+var ErrUnknownCluster = errors.New("unknown cluster")
+
+// AllClusters selects every registered cluster wherever a cluster name is
+// accepted.
+const AllClusters = "all"
+
+// ClusterRegistry holds one KubernetesService per managed cluster. The first
+// cluster registered is the default for requests that do not name one.
+type ClusterRegistry struct {
+	mu             sync.RWMutex
+	clusters       map[string]*KubernetesService
+	order          []string
+	defaultCluster string
+	logger         *log.Logger
+}
+
+func NewClusterRegistry(logger *log.Logger) *ClusterRegistry {
+	return &ClusterRegistry{clusters: make(map[string]*KubernetesService), logger: logger}
+}
+
+func (r *ClusterRegistry) Register(service *KubernetesService) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name := service.Name()
+	if _, exists := r.clusters[name]; exists {
+		return fmt.Errorf("cluster %q is already registered", name)
+	}
+	r.clusters[name] = service
+	r.order = append(r.order, name)
+	if r.defaultCluster == "" {
+		r.defaultCluster = name
+	}
+	r.logger.Printf("Registered cluster %s", name)
+	return nil
+}
+
+// Get returns the named cluster, or the default cluster when name is empty.
+func (r *ClusterRegistry) Get(name string) (*KubernetesService, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if name == "" {
+		name = r.defaultCluster
+	}
+	service, ok := r.clusters[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCluster, name)
+	}
+	return service, nil
+}
+
+// Select resolves a cluster query parameter: one named cluster, the default
+// cluster when empty, or every cluster for AllClusters.
+func (r *ClusterRegistry) Select(name string) ([]*KubernetesService, error) {
+	if name == AllClusters {
+		return r.All(), nil
+	}
+	service, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return []*KubernetesService{service}, nil
+}
+
+// All returns the registered clusters in registration order.
+func (r *ClusterRegistry) All() []*KubernetesService {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	services := make([]*KubernetesService, 0, len(r.order))
+	for _, name := range r.order {
+		services = append(services, r.clusters[name])
+	}
+	return services
+}
+
+func (r *ClusterRegistry) Start(stopCh <-chan struct{}) {
+	for _, service := range r.All() {
+		service.Start(stopCh)
+	}
+}
+
+// Health pings every cluster concurrently, each bounded by timeout.
+func (r *ClusterRegistry) Health(timeout time.Duration) []models.ClusterHealth {
+	services := r.All()
+	health := make([]models.ClusterHealth, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func(i int, service *KubernetesService) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			health[i] = models.ClusterHealth{Name: service.Name(), Status: "healthy"}
+			if err := service.Ping(ctx); err != nil {
+				health[i].Status = "unreachable"
+				health[i].Error = err.Error()
+			}
+		}(i, service)
+	}
+	wg.Wait()
+	return health
+}
+
+// CacheHealth reports every cluster from the sync state of its informer
+// caches, without calling its API server, so it is cheap enough to serve
+// unauthenticated probes.
+func (r *ClusterRegistry) CacheHealth() []models.ClusterHealth {
+	services := r.All()
+	health := make([]models.ClusterHealth, len(services))
+	for i, service := range services {
+		health[i] = models.ClusterHealth{Name: service.Name(), Status: "healthy"}
+		switch {
+		case service.client == nil:
+			health[i].Status = "unreachable"
+			health[i].Error = "Kubernetes client not initialized"
+		case !service.hasSynced():
+			health[i].Status = "syncing"
+		}
+	}
+	return health
+}
+
+// Subscribe merges the event streams of every registered cluster.
+func (r *ClusterRegistry) Subscribe() (<-chan models.WatchEvent, func()) {
+	out := make(chan models.WatchEvent, subscriberBuffer)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	var cancels []func()
+	for _, service := range r.All() {
+		events, cancel := service.Subscribe()
+		cancels = append(cancels, cancel)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range events {
+				select {
+				case out <- event:
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			close(done)
+			for _, cancel := range cancels {
+				cancel()
+			}
+			wg.Wait()
+			close(out)
+		})
+	}
+}
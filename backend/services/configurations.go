@@ -0,0 +1,360 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var akriConfigurationGVR = schema.GroupVersionResource{Group: "akri.sh", Version: "v0", Resource: "configurations"}
+
+var (
+	ErrUnknownTemplate      = errors.New("unknown configuration template")
+	ErrInvalidConfiguration = errors.New("invalid configuration")
+)
+
+// configurationTemplates are the starting points offered when onboarding a new
+// device class. Discovery details use the YAML format of the Akri discovery
+// handler named in each template.
+var configurationTemplates = []models.AkriConfigurationTemplate{
+	{
+		Name:        "esp32-udev",
+		Description: "ESP32 boards attached over USB serial, discovered by udev",
+		DiscoveryHandler: models.DiscoveryHandler{
+			Name: "udev",
+			DiscoveryDetails: "groupRecursive: true\n" +
+				"udevRules:\n" +
+				"- 'SUBSYSTEM==\"tty\", ATTRS{idVendor}==\"303a\"'\n" +
+				"- 'SUBSYSTEM==\"tty\", ATTRS{idVendor}==\"10c4\", ATTRS{idProduct}==\"ea60\"'\n",
+		},
+		BrokerProperties: map[string]string{"DEVICE": "esp32", "APPLICATION_TYPE": ""},
+		Capacity:         1,
+	},
+	{
+		Name:             "udev",
+		Description:      "Generic udev discovery; fill in udevRules",
+		DiscoveryHandler: models.DiscoveryHandler{Name: "udev", DiscoveryDetails: "udevRules: []\n"},
+		BrokerProperties: map[string]string{"DEVICE": "", "APPLICATION_TYPE": ""},
+		Capacity:         1,
+	},
+	{
+		Name:        "onvif",
+		Description: "ONVIF IP cameras on the local network",
+		DiscoveryHandler: models.DiscoveryHandler{
+			Name: "onvif",
+			DiscoveryDetails: "ipAddresses:\n  action: Exclude\n  items: []\n" +
+				"macAddresses:\n  action: Exclude\n  items: []\n" +
+				"scopes:\n  action: Include\n  items: []\n" +
+				"discoveryTimeoutSeconds: 1\n",
+		},
+		BrokerProperties: map[string]string{"DEVICE": "camera", "APPLICATION_TYPE": ""},
+		Capacity:         1,
+	},
+	{
+		Name:        "opcua",
+		Description: "OPC UA servers found through the local discovery server",
+		DiscoveryHandler: models.DiscoveryHandler{
+			Name:             "opcua",
+			DiscoveryDetails: "opcuaDiscoveryMethod:\n  standard: {}\napplicationNames:\n  action: Exclude\n  items: []\n",
+		},
+		BrokerProperties: map[string]string{"DEVICE": "opcua-server", "APPLICATION_TYPE": ""},
+		Capacity:         1,
+	},
+	{
+		Name:             "debugEcho",
+		Description:      "Fake devices from the debugEcho handler, for testing",
+		DiscoveryHandler: models.DiscoveryHandler{Name: "debugEcho", DiscoveryDetails: "descriptions:\n- \"foo0\"\n"},
+		BrokerProperties: map[string]string{"DEVICE": "debug", "APPLICATION_TYPE": ""},
+		Capacity:         1,
+	},
+}
+
+func ConfigurationTemplates() []models.AkriConfigurationTemplate {
+	return configurationTemplates
+}
+
+func configurationTemplate(name string) (models.AkriConfigurationTemplate, bool) {
+	for _, template := range configurationTemplates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return models.AkriConfigurationTemplate{}, false
+}
+
+// akriNamespaceFor validates a requested Configuration namespace, defaulting
+// to the first watched Akri namespace.
+func (s *KubernetesService) akriNamespaceFor(namespace string) (string, error) {
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		if len(s.namespaces) > 0 {
+			return s.namespaces[0], nil
+		}
+		return s.flashJobNamespace, nil
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", fmt.Errorf("%w %q: %s", ErrInvalidNamespace, namespace, strings.Join(errs, ", "))
+	}
+	return namespace, nil
+}
+
+func (s *KubernetesService) ListAkriConfigurations(namespace string) ([]models.AkriConfiguration, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, returning empty configuration list")
+		return []models.AkriConfiguration{}, errors.New("Kubernetes client not initialized")
+	}
+	if namespace == AllNamespaces {
+		namespace = metav1.NamespaceAll
+	} else {
+		var err error
+		if namespace, err = s.akriNamespaceFor(namespace); err != nil {
+			return []models.AkriConfiguration{}, err
+		}
+	}
+
+	list, err := s.client.Resource(akriConfigurationGVR).Namespace(namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to list Akri configurations: %v", err)
+		return []models.AkriConfiguration{}, err
+	}
+	counts := s.instanceCountsByConfiguration()
+	configurations := make([]models.AkriConfiguration, 0, len(list.Items))
+	for _, item := range list.Items {
+		configuration := s.akriConfigurationFromUnstructured(&item)
+		configuration.InstanceCount = counts[item.GetNamespace()+"/"+item.GetName()]
+		configurations = append(configurations, configuration)
+	}
+	s.logger.Printf("Retrieved %d Akri configurations", len(configurations))
+	return configurations, nil
+}
+
+// GetAkriConfiguration returns a Configuration together with the cached
+// instances Akri discovered for it.
+func (s *KubernetesService) GetAkriConfiguration(namespace, name string) (models.AkriConfigurationDetail, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot get Akri configuration")
+		return models.AkriConfigurationDetail{}, errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.akriNamespaceFor(namespace)
+	if err != nil {
+		return models.AkriConfigurationDetail{}, err
+	}
+
+	item, err := s.client.Resource(akriConfigurationGVR).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to get Akri configuration %s: %v", name, err)
+		return models.AkriConfigurationDetail{}, err
+	}
+
+	instances := []models.AkriInstance{}
+	objects, err := s.listCachedInstances([]string{namespace})
+	if err != nil && !errors.Is(err, ErrNamespaceNotWatched) {
+		return models.AkriConfigurationDetail{}, err
+	}
+	jobs := s.indexFlashJobs()
+	for _, obj := range objects {
+		instanceItem, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		if configurationName, _, _ := unstructured.NestedString(instanceItem.Object, "spec", "configurationName"); configurationName != name {
+			continue
+		}
+		if instance, ok := s.akriInstanceFromUnstructured(instanceItem, jobs); ok {
+			instances = append(instances, instance)
+		}
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].UUID < instances[j].UUID })
+
+	configuration := s.akriConfigurationFromUnstructured(item)
+	configuration.InstanceCount = len(instances)
+	return models.AkriConfigurationDetail{AkriConfiguration: configuration, Instances: instances}, nil
+}
+
+// CreateAkriConfiguration creates a Configuration from req.Template, with any
+// discovery handler, brokerProperties or capacity in req taking precedence.
+func (s *KubernetesService) CreateAkriConfiguration(req models.AkriConfigurationRequest) (models.AkriConfiguration, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot create Akri configuration")
+		return models.AkriConfiguration{}, errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.akriNamespaceFor(req.Namespace)
+	if err != nil {
+		return models.AkriConfiguration{}, err
+	}
+	if errs := validation.IsDNS1123Subdomain(req.Name); len(errs) > 0 {
+		return models.AkriConfiguration{}, fmt.Errorf("%w: name %q: %s", ErrInvalidConfiguration, req.Name, strings.Join(errs, ", "))
+	}
+
+	template := models.AkriConfigurationTemplate{Capacity: 1}
+	if req.Template != "" {
+		var ok bool
+		if template, ok = configurationTemplate(req.Template); !ok {
+			return models.AkriConfiguration{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, req.Template)
+		}
+	}
+	handler := template.DiscoveryHandler
+	if req.DiscoveryHandler != nil {
+		handler = *req.DiscoveryHandler
+	}
+	if handler.Name == "" {
+		return models.AkriConfiguration{}, fmt.Errorf("%w: a template or discovery handler is required", ErrInvalidConfiguration)
+	}
+	brokerProps := map[string]interface{}{}
+	for key, value := range template.BrokerProperties {
+		brokerProps[key] = value
+	}
+	for key, value := range req.BrokerProperties {
+		brokerProps[key] = value
+	}
+	capacity := template.Capacity
+	if req.Capacity != nil {
+		capacity = *req.Capacity
+	}
+
+	configuration := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "akri.sh/v0",
+			"kind":       "Configuration",
+			"metadata": map[string]interface{}{
+				"name":      req.Name,
+				"namespace": namespace,
+			},
+			"spec": map[string]interface{}{
+				"discoveryHandler": map[string]interface{}{
+					"name":             handler.Name,
+					"discoveryDetails": handler.DiscoveryDetails,
+				},
+				"brokerProperties": brokerProps,
+				"capacity":         capacity,
+			},
+		},
+	}
+	item, err := s.client.Resource(akriConfigurationGVR).Namespace(namespace).Create(context.Background(), configuration, metav1.CreateOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to create Akri configuration %s: %v", req.Name, err)
+		return models.AkriConfiguration{}, err
+	}
+	s.logger.Printf("Created Akri configuration %s/%s from template %q", namespace, req.Name, req.Template)
+	return s.akriConfigurationFromUnstructured(item), nil
+}
+
+// UpdateAkriConfiguration replaces the discovery handler, brokerProperties
+// and capacity given in req. With req.ResourceVersion, the version the caller
+// last saw, an edit made since surfaces as a conflict; without it the
+// update overwrites whatever is stored.
+func (s *KubernetesService) UpdateAkriConfiguration(namespace, name string, req models.AkriConfigurationRequest) (models.AkriConfiguration, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot update Akri configuration")
+		return models.AkriConfiguration{}, errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.akriNamespaceFor(namespace)
+	if err != nil {
+		return models.AkriConfiguration{}, err
+	}
+
+	resource := s.client.Resource(akriConfigurationGVR).Namespace(namespace)
+	item, err := resource.Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to get Akri configuration %s: %v", name, err)
+		return models.AkriConfiguration{}, err
+	}
+	if req.ResourceVersion != "" {
+		item.SetResourceVersion(req.ResourceVersion)
+	}
+
+	if req.Template != "" {
+		template, ok := configurationTemplate(req.Template)
+		if !ok {
+			return models.AkriConfiguration{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, req.Template)
+		}
+		if req.DiscoveryHandler == nil {
+			req.DiscoveryHandler = &template.DiscoveryHandler
+		}
+		if req.BrokerProperties == nil {
+			req.BrokerProperties = template.BrokerProperties
+		}
+	}
+	if req.DiscoveryHandler != nil {
+		if req.DiscoveryHandler.Name == "" {
+			return models.AkriConfiguration{}, fmt.Errorf("%w: discovery handler name is required", ErrInvalidConfiguration)
+		}
+		handler := map[string]interface{}{
+			"name":             req.DiscoveryHandler.Name,
+			"discoveryDetails": req.DiscoveryHandler.DiscoveryDetails,
+		}
+		if err := unstructured.SetNestedMap(item.Object, handler, "spec", "discoveryHandler"); err != nil {
+			return models.AkriConfiguration{}, err
+		}
+	}
+	if req.BrokerProperties != nil {
+		if err := unstructured.SetNestedStringMap(item.Object, req.BrokerProperties, "spec", "brokerProperties"); err != nil {
+			return models.AkriConfiguration{}, err
+		}
+	}
+	if req.Capacity != nil {
+		if err := unstructured.SetNestedField(item.Object, *req.Capacity, "spec", "capacity"); err != nil {
+			return models.AkriConfiguration{}, err
+		}
+	}
+
+	updated, err := resource.Update(context.Background(), item, metav1.UpdateOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to update Akri configuration %s: %v", name, err)
+		return models.AkriConfiguration{}, err
+	}
+	s.logger.Printf("Updated Akri configuration %s/%s", namespace, name)
+	return s.akriConfigurationFromUnstructured(updated), nil
+}
+
+func (s *KubernetesService) akriConfigurationFromUnstructured(item *unstructured.Unstructured) models.AkriConfiguration {
+	handlerName, _, _ := unstructured.NestedString(item.Object, "spec", "discoveryHandler", "name")
+	details, _, _ := unstructured.NestedString(item.Object, "spec", "discoveryHandler", "discoveryDetails")
+	capacity, _, _ := unstructured.NestedInt64(item.Object, "spec", "capacity")
+	_, hasBroker, _ := unstructured.NestedMap(item.Object, "spec", "brokerSpec")
+	return models.AkriConfiguration{
+		Name:      item.GetName(),
+		Namespace: item.GetNamespace(),
+		Cluster:   s.name,
+		DiscoveryHandler: models.DiscoveryHandler{
+			Name:             handlerName,
+			DiscoveryDetails: details,
+		},
+		BrokerProperties: brokerProperties(item),
+		Capacity:         capacity,
+		HasBroker:        hasBroker,
+		CreatedAt:        item.GetCreationTimestamp().UTC().Format(time.RFC3339),
+		ResourceVersion:  item.GetResourceVersion(),
+	}
+}
+
+// instanceCountsByConfiguration counts cached instances per
+// "namespace/configurationName".
+func (s *KubernetesService) instanceCountsByConfiguration() map[string]int {
+	counts := map[string]int{}
+	if !s.hasSynced() {
+		return counts
+	}
+	objects, err := s.listCachedInstances(nil)
+	if err != nil {
+		return counts
+	}
+	for _, obj := range objects {
+		item, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		configurationName, _, _ := unstructured.NestedString(item.Object, "spec", "configurationName")
+		counts[item.GetNamespace()+"/"+configurationName]++
+	}
+	return counts
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"log"
+	"sync"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind by
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+type EventHub struct {
+	mu          sync.Mutex
+	subscribers map[chan models.WatchEvent]struct{}
+	logger      *log.Logger
+}
+
+func NewEventHub(logger *log.Logger) *EventHub {
+	return &EventHub{subscribers: make(map[chan models.WatchEvent]struct{}), logger: logger}
+}
+
+// Subscribe registers a new listener. The returned function must be called
+// once the listener is done, otherwise the channel is never released.
+func (h *EventHub) Subscribe() (<-chan models.WatchEvent, func()) {
+	ch := make(chan models.WatchEvent, subscriberBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers, ch)
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish fans the event out without blocking on slow subscribers.
+func (h *EventHub) Publish(event models.WatchEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		select {
+		case ch <- event:
+		default:
+			h.logger.Printf("Dropping %s %s event for slow subscriber", event.Kind, event.Type)
+		}
+	}
+}
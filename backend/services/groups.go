@@ -0,0 +1,272 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	ErrGroupNotFound = errors.New("device group not found")
+	ErrGroupExists   = errors.New("device group already exists")
+	ErrInvalidGroup  = errors.New("invalid device group")
+	ErrInvalidLabels = errors.New("invalid device labels")
+)
+
+// Redis hashes holding device labels (keyed by UUID) and device groups
+// (keyed by name) as JSON.
+const (
+	deviceLabelsKey = "device-labels"
+	deviceGroupsKey = "device-groups"
+)
+
+// DeviceGroups stores user-assigned device labels and named device groups,
+// and resolves selectors against a cluster's current instances.
+type DeviceGroups struct {
+	mu     sync.Mutex
+	redis  *RedisService
+	logger *log.Logger
+}
+
+func NewDeviceGroups(redis *RedisService, logger *log.Logger) *DeviceGroups {
+	return &DeviceGroups{redis: redis, logger: logger}
+}
+
+// AllLabels returns the labels of every labelled device, keyed by UUID.
+func (g *DeviceGroups) AllLabels() (map[string]map[string]string, error) {
+	values, err := g.redis.HGetAllValues(deviceLabelsKey)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]map[string]string, len(values))
+	for uuid, value := range values {
+		var deviceLabels map[string]string
+		if err := json.Unmarshal([]byte(value), &deviceLabels); err != nil {
+			g.logger.Printf("Skipping unreadable labels of %s: %v", uuid, err)
+			continue
+		}
+		all[uuid] = deviceLabels
+	}
+	return all, nil
+}
+
+// UpdateLabels sets the given labels and removes the keys in remove on
+// every device in uuids.
+func (g *DeviceGroups) UpdateLabels(uuids []string, set map[string]string, remove []string) (map[string]map[string]string, error) {
+	if err := validateLabels(set); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	all, err := g.AllLabels()
+	if err != nil {
+		return nil, err
+	}
+	updated := make(map[string]map[string]string, len(uuids))
+	for _, uuid := range uuids {
+		deviceLabels := all[uuid]
+		if deviceLabels == nil {
+			deviceLabels = map[string]string{}
+		}
+		for key, value := range set {
+			deviceLabels[key] = value
+		}
+		for _, key := range remove {
+			delete(deviceLabels, key)
+		}
+		if len(deviceLabels) == 0 {
+			err = g.redis.HDelete(deviceLabelsKey, uuid)
+		} else {
+			err = g.redis.HSetValue(deviceLabelsKey, uuid, deviceLabels)
+		}
+		if err != nil {
+			return nil, err
+		}
+		updated[uuid] = deviceLabels
+	}
+	g.logger.Printf("Updated labels of %d devices", len(uuids))
+	return updated, nil
+}
+
+// ReplaceLabels sets the device's labels to exactly deviceLabels.
+func (g *DeviceGroups) ReplaceLabels(uuid string, deviceLabels map[string]string) error {
+	if err := validateLabels(deviceLabels); err != nil {
+		return err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(deviceLabels) == 0 {
+		return g.redis.HDelete(deviceLabelsKey, uuid)
+	}
+	return g.redis.HSetValue(deviceLabelsKey, uuid, deviceLabels)
+}
+
+func validateLabels(deviceLabels map[string]string) error {
+	for key, value := range deviceLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("%w: key %q: %s", ErrInvalidLabels, key, strings.Join(errs, ", "))
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("%w: value %q of %s: %s", ErrInvalidLabels, value, key, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+func (g *DeviceGroups) ListGroups() ([]models.DeviceGroup, error) {
+	values, err := g.redis.HGetAllValues(deviceGroupsKey)
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]models.DeviceGroup, 0, len(values))
+	for name, value := range values {
+		var group models.DeviceGroup
+		if err := json.Unmarshal([]byte(value), &group); err != nil {
+			g.logger.Printf("Skipping unreadable device group %s: %v", name, err)
+			continue
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+func (g *DeviceGroups) GetGroup(name string) (models.DeviceGroup, error) {
+	var group models.DeviceGroup
+	found, err := g.redis.HGetValue(deviceGroupsKey, name, &group)
+	if err != nil {
+		return models.DeviceGroup{}, err
+	}
+	if !found {
+		return models.DeviceGroup{}, fmt.Errorf("%w: %s", ErrGroupNotFound, name)
+	}
+	return group, nil
+}
+
+// SaveGroup creates the group, or replaces it when update is set.
+func (g *DeviceGroups) SaveGroup(group models.DeviceGroup, update bool) (models.DeviceGroup, error) {
+	group.Name = strings.TrimSpace(group.Name)
+	group.Selector = strings.TrimSpace(group.Selector)
+	group.UUIDs = trimmedValues(group.UUIDs)
+	if errs := validation.IsDNS1123Label(group.Name); len(errs) > 0 {
+		return models.DeviceGroup{}, fmt.Errorf("%w: name %q: %s", ErrInvalidGroup, group.Name, strings.Join(errs, ", "))
+	}
+	if group.Selector == "" && len(group.UUIDs) == 0 {
+		return models.DeviceGroup{}, fmt.Errorf("%w: a selector or UUIDs are required", ErrInvalidGroup)
+	}
+	if _, err := parseDeviceSelector(group.Selector); err != nil {
+		return models.DeviceGroup{}, err
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	existing, err := g.GetGroup(group.Name)
+	switch {
+	case err == nil && !update:
+		return models.DeviceGroup{}, fmt.Errorf("%w: %s", ErrGroupExists, group.Name)
+	case errors.Is(err, ErrGroupNotFound) && update:
+		return models.DeviceGroup{}, err
+	case err != nil && !errors.Is(err, ErrGroupNotFound):
+		return models.DeviceGroup{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	group.CreatedAt = existing.CreatedAt
+	if group.CreatedAt == "" {
+		group.CreatedAt = now
+	}
+	group.UpdatedAt = now
+	if err := g.redis.HSetValue(deviceGroupsKey, group.Name, group); err != nil {
+		return models.DeviceGroup{}, err
+	}
+	g.logger.Printf("Saved device group %s", group.Name)
+	return group, nil
+}
+
+func (g *DeviceGroups) DeleteGroup(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if _, err := g.GetGroup(name); err != nil {
+		return err
+	}
+	return g.redis.HDelete(deviceGroupsKey, name)
+}
+
+// Members returns the devices of cluster the target selects, in instance
+// order. Listed UUIDs not currently present are left out.
+func (g *DeviceGroups) Members(cluster *KubernetesService, target models.RolloutTarget) ([]models.AkriInstanceDetail, error) {
+	if target.Group == "" && target.Selector == "" {
+		return nil, fmt.Errorf("%w: a group or selector is required", ErrInvalidGroup)
+	}
+	var group *models.DeviceGroup
+	var groupSelector, selector labels.Selector
+	if target.Group != "" {
+		found, err := g.GetGroup(target.Group)
+		if err != nil {
+			return nil, err
+		}
+		group = &found
+		if groupSelector, err = parseDeviceSelector(found.Selector); err != nil {
+			return nil, err
+		}
+	}
+	selector, err := parseDeviceSelector(target.Selector)
+	if err != nil {
+		return nil, err
+	}
+
+	details, err := cluster.GetAkriInstanceDetails()
+	if err != nil {
+		return nil, err
+	}
+	all, err := g.AllLabels()
+	if err != nil {
+		return nil, err
+	}
+	var members []models.AkriInstanceDetail
+	for _, detail := range details {
+		set := deviceLabelSet(detail, all[detail.UUID])
+		if group != nil && !containsString(group.UUIDs, detail.UUID) && (groupSelector == nil || !groupSelector.Matches(set)) {
+			continue
+		}
+		if selector != nil && !selector.Matches(set) {
+			continue
+		}
+		members = append(members, detail)
+	}
+	return members, nil
+}
+
+// parseDeviceSelector parses a label selector such as
+// "site=plant-3,DEVICE in (esp32,esp32s3)". An empty selector yields nil.
+func parseDeviceSelector(selector string) (labels.Selector, error) {
+	if strings.TrimSpace(selector) == "" {
+		return nil, nil
+	}
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, fmt.Errorf("%w: selector %q: %v", ErrInvalidGroup, selector, err)
+	}
+	return parsed, nil
+}
+
+// deviceLabelSet is what selectors match against: the instance's
+// brokerProperties, overridden by the labels users attached to it.
+func deviceLabelSet(detail models.AkriInstanceDetail, deviceLabels map[string]string) labels.Set {
+	set := make(labels.Set, len(detail.BrokerProperties)+len(deviceLabels))
+	for key, value := range detail.BrokerProperties {
+		set[key] = value
+	}
+	for key, value := range deviceLabels {
+		set[key] = value
+	}
+	return set
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+// firmwareHistoryLimit caps how many records are kept per device.
+const firmwareHistoryLimit = 50
+
+// flashedFirmwareKey is the Redis hash holding, per device UUID, the record
+// of the last FlashJob that flashed it successfully.
+const flashedFirmwareKey = "flashed-firmware"
+
+func firmwareHistoryKey(uuid string) string {
+	return "firmware-history:" + uuid
+}
+
+// FirmwareHistory keeps, per device UUID, the firmware of every FlashJob
+// that flashed it successfully, newest first, and the last of them on its
+// own. Both outlive the FlashJobs, so they still answer once a FlashJob has
+// been deleted. FlashJobs that fail leave no trace.
+type FirmwareHistory struct {
+	mu      sync.Mutex
+	flashed map[string]models.FirmwareRecord
+	redis   *RedisService
+	logger  *log.Logger
+}
+
+func NewFirmwareHistory(redis *RedisService, logger *log.Logger) *FirmwareHistory {
+	return &FirmwareHistory{redis: redis, logger: logger}
+}
+
+// RecordFlashed records, for every device the FlashJob has flashed
+// successfully, that the device now runs the FlashJob's firmware. FlashJob
+// updates repeat, so each device is recorded once per FlashJob, and a
+// FlashJob created before the one last recorded for the device is ignored.
+func (h *FirmwareHistory) RecordFlashed(cluster string, job models.FlashJob) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.loadFlashed() {
+		return
+	}
+	for _, device := range job.Status.Devices {
+		if !successfulPhases[strings.ToLower(device.Phase)] {
+			continue
+		}
+		last, ok := h.flashed[device.UUID]
+		if ok && ((last.FlashJob == job.Name && last.Cluster == cluster) || last.FlashJobCreatedAt > job.CreatedAt) {
+			continue
+		}
+		record := models.FirmwareRecord{
+			Firmware:          job.Firmware,
+			FlashjobPodImage:  job.FlashjobPodImage,
+			Version:           job.Version,
+			FlashJob:          job.Name,
+			FlashJobCreatedAt: job.CreatedAt,
+			Cluster:           cluster,
+			Namespace:         job.Namespace,
+			Succeeded:         true,
+			Rollback:          job.Rollback,
+			Timestamp:         time.Now().Unix(),
+		}
+		if err := h.redis.HSetValue(flashedFirmwareKey, device.UUID, record); err != nil {
+			h.logger.Printf("Failed to record firmware %s flashed onto %s: %v", job.Firmware, device.UUID, err)
+			continue
+		}
+		h.flashed[device.UUID] = record
+		key := firmwareHistoryKey(device.UUID)
+		h.redis.LPushList(key, record)
+		h.redis.LTrimList(key, 0, firmwareHistoryLimit-1)
+		h.logger.Printf("Recorded firmware %s flashed onto %s by FlashJob %s", job.Firmware, device.UUID, job.Name)
+	}
+}
+
+// LastFlashed returns the record of the last FlashJob that flashed the
+// device successfully.
+func (h *FirmwareHistory) LastFlashed(uuid string) (models.FirmwareRecord, bool) {
+	if h == nil {
+		return models.FirmwareRecord{}, false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.loadFlashed() {
+		return models.FirmwareRecord{}, false
+	}
+	record, ok := h.flashed[uuid]
+	return record, ok
+}
+
+// loadFlashed reads the flashed firmware records into memory the first time
+// they are needed; callers hold h.mu. It reports whether they are loaded.
+func (h *FirmwareHistory) loadFlashed() bool {
+	if h.flashed != nil {
+		return true
+	}
+	values, err := h.redis.HGetAllValues(flashedFirmwareKey)
+	if err != nil {
+		h.logger.Printf("Failed to read flashed firmware records: %v", err)
+		return false
+	}
+	h.flashed = make(map[string]models.FirmwareRecord, len(values))
+	for uuid, value := range values {
+		var record models.FirmwareRecord
+		if err := json.Unmarshal([]byte(value), &record); err != nil {
+			h.logger.Printf("Skipping unreadable flashed firmware record %s: %v", uuid, err)
+			continue
+		}
+		h.flashed[uuid] = record
+	}
+	return true
+}
+
+// History returns the device's records, newest first.
+func (h *FirmwareHistory) History(uuid string) ([]models.FirmwareRecord, error) {
+	items, err := h.redis.LRangeValues(firmwareHistoryKey(uuid), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]models.FirmwareRecord, 0, len(items))
+	for _, item := range items {
+		var record models.FirmwareRecord
+		if err := json.Unmarshal([]byte(item), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// Previous returns the firmware to roll the device back to; ok is false
+// when there is none. See previousFirmware.
+func (h *FirmwareHistory) Previous(uuid string) (record models.FirmwareRecord, ok bool, err error) {
+	records, err := h.History(uuid)
+	if err != nil {
+		return models.FirmwareRecord{}, false, err
+	}
+	record, ok = previousFirmware(records)
+	return record, ok, nil
+}
+
+// previousFirmware replays records, newest first, as a stack: each flash
+// pushes its firmware and each rollback pops back down to the firmware it
+// restored, so rolling back twice goes two steps back rather than undoing
+// the first rollback. The result is the newest entry below the top whose
+// image differs from it. Records written before flashes were only recorded
+// on success are ignored.
+func previousFirmware(records []models.FirmwareRecord) (models.FirmwareRecord, bool) {
+	var stack []models.FirmwareRecord
+	for i := len(records) - 1; i >= 0; i-- {
+		record := records[i]
+		if !record.Succeeded {
+			continue
+		}
+		if record.Rollback {
+			for len(stack) > 0 && !sameFirmware(stack[len(stack)-1], record) {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) > 0 {
+				continue
+			}
+		}
+		stack = append(stack, record)
+	}
+	if len(stack) == 0 {
+		return models.FirmwareRecord{}, false
+	}
+	current := stack[len(stack)-1]
+	for i := len(stack) - 2; i >= 0; i-- {
+		if !sameFirmware(stack[i], current) {
+			return stack[i], true
+		}
+	}
+	return models.FirmwareRecord{}, false
+}
+
+// sameFirmware reports whether a and b flashed the same image and version.
+// Records are digest-pinned only when the registry or signatures were
+// checked, so digests are compared only when both records carry one.
+func sameFirmware(a, b models.FirmwareRecord) bool {
+	if a.Version != b.Version || !SameImage(a.Firmware, b.Firmware) {
+		return false
+	}
+	_, digestA, pinnedA := strings.Cut(a.Firmware, "@")
+	_, digestB, pinnedB := strings.Cut(b.Firmware, "@")
+	return !pinnedA || !pinnedB || digestA == digestB
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+const (
+	digest1 = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	digest2 = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+func flashed(firmware string) models.FirmwareRecord {
+	return models.FirmwareRecord{Firmware: firmware, Version: "1", Succeeded: true}
+}
+
+func rolledBack(firmware string) models.FirmwareRecord {
+	record := flashed(firmware)
+	record.Rollback = true
+	return record
+}
+
+func TestPreviousFirmware(t *testing.T) {
+	failed := flashed("fw:b")
+	failed.Succeeded = false
+	tests := []struct {
+		name string
+		// chronological lists the records oldest first; the history
+		// stores them newest first.
+		chronological []models.FirmwareRecord
+		want          string
+	}{
+		{"no history", nil, ""},
+		{"single flash", []models.FirmwareRecord{flashed("fw:a")}, ""},
+		{"one step back", []models.FirmwareRecord{flashed("fw:a"), flashed("fw:b")}, "fw:a"},
+		{"reflashing the same image", []models.FirmwareRecord{flashed("fw:a"), flashed("fw:b"), flashed("fw:b")}, "fw:a"},
+		{"rolling back twice goes two steps back", []models.FirmwareRecord{flashed("fw:a"), flashed("fw:b"), flashed("fw:c"), rolledBack("fw:b")}, "fw:a"},
+		{"nothing below the oldest", []models.FirmwareRecord{flashed("fw:a"), flashed("fw:b"), rolledBack("fw:a")}, ""},
+		{"rollback past the kept history", []models.FirmwareRecord{flashed("fw:a"), flashed("fw:b"), rolledBack("fw:z")}, ""},
+		{"failed records are skipped", []models.FirmwareRecord{flashed("fw:a"), failed}, ""},
+		{"unpinned rollback matches the pinned flash", []models.FirmwareRecord{flashed("fw:a"), flashed("fw:b@" + digest1), flashed("fw:c"), rolledBack("fw:b")}, "fw:a"},
+		{"normalized references match", []models.FirmwareRecord{flashed("nginx:a"), flashed("nginx:b"), flashed("nginx:c"), rolledBack("docker.io/library/nginx:b")}, "nginx:a"},
+		{"same tag with another digest differs", []models.FirmwareRecord{flashed("fw:a@" + digest1), flashed("fw:a@" + digest2)}, "fw:a@" + digest1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records := make([]models.FirmwareRecord, len(tt.chronological))
+			for i, record := range tt.chronological {
+				records[len(records)-1-i] = record
+			}
+			got, ok := previousFirmware(records)
+			if ok != (tt.want != "") || got.Firmware != tt.want {
+				t.Errorf("previousFirmware = (%q, %v), want %q", got.Firmware, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestSameFirmware(t *testing.T) {
+	tests := []struct {
+		a, b models.FirmwareRecord
+		want bool
+	}{
+		{flashed("fw:a"), flashed("fw:a"), true},
+		{flashed("fw:a"), flashed("fw:b"), false},
+		{flashed("nginx:1"), flashed("docker.io/library/nginx:1"), true},
+		{flashed("fw:a@" + digest1), flashed("fw:a"), true},
+		{flashed("fw:a@" + digest1), flashed("fw:a@" + digest1), true},
+		{flashed("fw:a@" + digest1), flashed("fw:a@" + digest2), false},
+		{flashed("fw:a"), models.FirmwareRecord{Firmware: "fw:a", Version: "2"}, false},
+	}
+	for _, tt := range tests {
+		if got := sameFirmware(tt.a, tt.b); got != tt.want {
+			t.Errorf("sameFirmware(%q v%s, %q v%s) = %v, want %v", tt.a.Firmware, tt.a.Version, tt.b.Firmware, tt.b.Version, got, tt.want)
+		}
+	}
+}
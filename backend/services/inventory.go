@@ -0,0 +1,299 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+var ErrDeviceNotFound = errors.New("device not in inventory")
+
+// inventoryKey is the Redis hash holding every inventory record as JSON,
+// keyed by UUID.
+const inventoryKey = "device-inventory"
+
+const (
+	// inventoryInterval bounds how stale last-seen times get and how late a
+	// disappearance missed by the watch is noticed.
+	inventoryInterval = time.Minute
+	// inventoryDebounce batches the burst of instance events an informer
+	// sync produces into one pass.
+	inventoryDebounce = 5 * time.Second
+	// inventoryEventLimit caps the events kept per device.
+	inventoryEventLimit = 100
+	// lastSeenRefresh is how often the last-seen time of a device that is
+	// otherwise unchanged is written, so a pass does not rewrite every
+	// record.
+	lastSeenRefresh = 5 * time.Minute
+)
+
+// InventoryFilter narrows Inventory.List. Zero values do not filter.
+// VanishedSince matches devices that vanished at or after it, even if they
+// have reappeared since. Last-seen times lag by up to lastSeenRefresh.
+type InventoryFilter struct {
+	Cluster       string
+	Present       *bool
+	VanishedSince time.Time
+	SeenSince     time.Time
+}
+
+// Inventory keeps a record of every device UUID ever seen in a cluster. It
+// compares each cluster's instances with the stored records whenever
+// instances change and once a minute.
+type Inventory struct {
+	mu       sync.Mutex
+	clusters *ClusterRegistry
+	redis    *RedisService
+	logger   *log.Logger
+}
+
+func NewInventory(clusters *ClusterRegistry, redis *RedisService, logger *log.Logger) *Inventory {
+	return &Inventory{clusters: clusters, redis: redis, logger: logger}
+}
+
+// Start records the current instances and keeps the inventory up to date
+// until stopCh is closed.
+func (inv *Inventory) Start(stopCh <-chan struct{}) {
+	events, cancel := inv.clusters.Subscribe()
+	go func() {
+		defer cancel()
+		ticker := time.NewTicker(inventoryInterval)
+		defer ticker.Stop()
+		debounce := time.NewTicker(inventoryDebounce)
+		defer debounce.Stop()
+
+		dirty := map[string]bool{}
+		inv.reconcileAll()
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				if event.Kind == "AkriInstance" {
+					dirty[event.Cluster] = true
+				}
+			case <-debounce.C:
+				for cluster := range dirty {
+					if service, err := inv.clusters.Get(cluster); err == nil {
+						inv.reconcile(service)
+					}
+				}
+				dirty = map[string]bool{}
+			case <-ticker.C:
+				inv.reconcileAll()
+			case <-stopCh:
+				return
+			}
+		}
+	}()
+}
+
+func (inv *Inventory) reconcileAll() {
+	for _, service := range inv.clusters.All() {
+		inv.reconcile(service)
+	}
+}
+
+// reconcile updates the records of one cluster from its current instances.
+// A cluster that cannot be listed is skipped, so an outage never reads as
+// every device vanishing.
+func (inv *Inventory) reconcile(service *KubernetesService) {
+	details, err := service.GetAkriInstanceDetails()
+	if err != nil {
+		inv.logger.Printf("Inventory: skipping cluster %s: %v", service.Name(), err)
+		return
+	}
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	devices, err := inv.load()
+	if err != nil {
+		inv.logger.Printf("Inventory: failed to read records, skipping cluster %s: %v", service.Name(), err)
+		return
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	seen := make(map[string]bool, len(details))
+	for _, detail := range details {
+		seen[detail.UUID] = true
+		device, known := devices[detail.UUID]
+		var before []byte
+		if known {
+			before, _ = json.Marshal(device)
+		}
+		switch {
+		case !known:
+			device = &models.InventoryDevice{UUID: detail.UUID, FirstSeen: now}
+			addInventoryEvent(device, models.InventoryEvent{Type: models.InventoryAppeared, Timestamp: now})
+		case !device.Present:
+			device.VanishedAt = ""
+			addInventoryEvent(device, models.InventoryEvent{Type: models.InventoryReappeared, Timestamp: now})
+		}
+		if changes := propertyChanges(device.BrokerProperties, detail.BrokerProperties); known && len(changes) > 0 {
+			addInventoryEvent(device, models.InventoryEvent{Type: models.InventoryPropertiesChanged, Timestamp: now, Changes: changes})
+		}
+		if changes := firmwareChanges(device, detail.AkriInstance); known && len(changes) > 0 {
+			addInventoryEvent(device, models.InventoryEvent{Type: models.InventoryFirmwareChanged, Timestamp: now, Changes: changes})
+		}
+		device.Cluster = service.Name()
+		device.Namespace = detail.Namespace
+		device.Name = detail.Name
+		device.DeviceType = detail.DeviceType
+		device.ApplicationType = detail.ApplicationType
+		device.BrokerProperties = detail.BrokerProperties
+		device.CurrentFirmware = detail.CurrentFirmware
+		device.CurrentVersion = detail.CurrentVersion
+		device.FirmwareSource = detail.FirmwareSource
+		device.Present = true
+		lastSeen := device.LastSeen
+		device.LastSeen = now
+		if known && notBefore(lastSeen, time.Now().Add(-lastSeenRefresh)) {
+			device.LastSeen = lastSeen
+			if after, _ := json.Marshal(device); bytes.Equal(before, after) {
+				continue
+			}
+			device.LastSeen = now
+		}
+		inv.save(device)
+	}
+
+	for uuid, device := range devices {
+		if device.Cluster != service.Name() || !device.Present || seen[uuid] {
+			continue
+		}
+		device.Present = false
+		device.VanishedAt = now
+		addInventoryEvent(device, models.InventoryEvent{Type: models.InventoryVanished, Timestamp: now})
+		inv.save(device)
+		inv.logger.Printf("Inventory: device %s vanished from cluster %s", uuid, device.Cluster)
+	}
+}
+
+// List returns the records matching filter, most recently seen first.
+func (inv *Inventory) List(filter InventoryFilter) ([]models.InventoryDevice, error) {
+	devices, err := inv.load()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]models.InventoryDevice, 0, len(devices))
+	for _, device := range devices {
+		if filter.Cluster != "" && device.Cluster != filter.Cluster {
+			continue
+		}
+		if filter.Present != nil && device.Present != *filter.Present {
+			continue
+		}
+		if !filter.VanishedSince.IsZero() && !vanishedSince(device, filter.VanishedSince) {
+			continue
+		}
+		if !filter.SeenSince.IsZero() && !notBefore(device.LastSeen, filter.SeenSince) {
+			continue
+		}
+		result = append(result, *device)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].LastSeen != result[j].LastSeen {
+			return result[i].LastSeen > result[j].LastSeen
+		}
+		return result[i].UUID < result[j].UUID
+	})
+	return result, nil
+}
+
+func (inv *Inventory) Get(uuid string) (models.InventoryDevice, error) {
+	var device models.InventoryDevice
+	found, err := inv.redis.HGetValue(inventoryKey, uuid, &device)
+	if err != nil {
+		return models.InventoryDevice{}, err
+	}
+	if !found {
+		return models.InventoryDevice{}, fmt.Errorf("%w: %s", ErrDeviceNotFound, uuid)
+	}
+	return device, nil
+}
+
+func (inv *Inventory) load() (map[string]*models.InventoryDevice, error) {
+	values, err := inv.redis.HGetAllValues(inventoryKey)
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string]*models.InventoryDevice, len(values))
+	for uuid, value := range values {
+		var device models.InventoryDevice
+		if err := json.Unmarshal([]byte(value), &device); err != nil {
+			inv.logger.Printf("Skipping unreadable inventory record %s: %v", uuid, err)
+			continue
+		}
+		devices[uuid] = &device
+	}
+	return devices, nil
+}
+
+func (inv *Inventory) save(device *models.InventoryDevice) {
+	if err := inv.redis.HSetValue(inventoryKey, device.UUID, device); err != nil {
+		inv.logger.Printf("Inventory: failed to save device %s: %v", device.UUID, err)
+	}
+}
+
+func addInventoryEvent(device *models.InventoryDevice, event models.InventoryEvent) {
+	device.Events = append(device.Events, event)
+	if len(device.Events) > inventoryEventLimit {
+		device.Events = device.Events[len(device.Events)-inventoryEventLimit:]
+	}
+}
+
+// propertyChanges diffs two brokerProperties maps.
+func propertyChanges(old, current map[string]string) map[string]models.PropertyChange {
+	changes := map[string]models.PropertyChange{}
+	for key, value := range current {
+		if old[key] != value {
+			changes[key] = models.PropertyChange{Old: old[key], New: value}
+		}
+	}
+	for key, value := range old {
+		if _, ok := current[key]; !ok {
+			changes[key] = models.PropertyChange{Old: value}
+		}
+	}
+	return changes
+}
+
+// firmwareChanges compares the firmware last recorded for device with what
+// the instance reports now. A device whose firmware becomes unknown is not a
+// change worth recording.
+func firmwareChanges(device *models.InventoryDevice, instance models.AkriInstance) map[string]models.PropertyChange {
+	if instance.CurrentFirmware == "" && instance.CurrentVersion == "" {
+		return nil
+	}
+	changes := map[string]models.PropertyChange{}
+	if device.CurrentFirmware != instance.CurrentFirmware {
+		changes["currentFirmware"] = models.PropertyChange{Old: device.CurrentFirmware, New: instance.CurrentFirmware}
+	}
+	if device.CurrentVersion != instance.CurrentVersion {
+		changes["currentVersion"] = models.PropertyChange{Old: device.CurrentVersion, New: instance.CurrentVersion}
+	}
+	return changes
+}
+
+// vanishedSince reports whether device has a vanished event at or after t.
+func vanishedSince(device *models.InventoryDevice, t time.Time) bool {
+	for _, event := range device.Events {
+		if event.Type == models.InventoryVanished && notBefore(event.Timestamp, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// notBefore reports whether the RFC 3339 timestamp is at or after t.
+func notBefore(timestamp string, t time.Time) bool {
+	parsed, err := time.Parse(time.RFC3339, timestamp)
+	return err == nil && !parsed.Before(t)
+}
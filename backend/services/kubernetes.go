@@ -2,147 +2,824 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"reflect"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
 )
 
+var (
+	akriInstanceGVR = schema.GroupVersionResource{Group: "akri.sh", Version: "v0", Resource: "instances"}
+	flashJobGVR     = schema.GroupVersionResource{Group: "application.flashjob.nbfc.io", Version: "v1alpha1", Resource: "flashjobs"}
+)
+
+var ErrEmptyPatch = errors.New("patch contains no changes")
+
+// instanceResync is how often the informer replays its cache to handlers even
+// without changes from the API server.
+const instanceResync = 10 * time.Minute
+
+var (
+	ErrCacheNotSynced      = errors.New("Akri instance cache has not synced yet")
+	ErrNamespaceNotWatched = errors.New("namespace is not watched by this backend")
+	ErrInvalidNamespace    = errors.New("invalid namespace")
+	ErrInstanceNotFound    = errors.New("Akri instance not found")
+)
+
+// AllNamespaces is accepted wherever a namespace is requested and stands for
+// every namespace the backend watches.
+const AllNamespaces = "all"
+
 type KubernetesService struct {
-	client dynamic.Interface
-	logger *log.Logger
+	name              string
+	client            dynamic.Interface
+	typed             kubernetes.Interface
+	logger            *log.Logger
+	namespaces        []string
+	flashJobNamespace string
+	informerFactories []dynamicinformer.DynamicSharedInformerFactory
+	instanceListers   map[string]cache.GenericLister
+	brokerPodListers  map[string]cache.GenericLister
+	flashJobListers   []cache.GenericLister
+	cacheSynced       []cache.InformerSynced
+	events            *EventHub
+	history           *FirmwareHistory
+
+	configurationListers map[string]cache.GenericLister
 }
 
-func NewKubernetesService(client dynamic.Interface, logger *log.Logger) *KubernetesService {
-	return &KubernetesService{client: client, logger: logger}
+// NewKubernetesService builds the service and its informers for the cluster
+// registered under name. namespaces lists the namespaces Akri instances are
+// read from; an empty list watches all of them. flashJobNamespace is where
+// rollouts land unless a request picks another namespace. typed serves the
+// core APIs, such as pod logs, that the dynamic client cannot; it may be nil.
+// Successful flashes seen by the FlashJob informers are recorded in history.
+func NewKubernetesService(name string, client dynamic.Interface, typed kubernetes.Interface, namespaces []string, flashJobNamespace string, history *FirmwareHistory, logger *log.Logger) *KubernetesService {
+	if flashJobNamespace == "" {
+		flashJobNamespace = "default"
+	}
+	s := &KubernetesService{
+		name:              name,
+		client:            client,
+		typed:             typed,
+		logger:            logger,
+		namespaces:        namespaces,
+		flashJobNamespace: flashJobNamespace,
+		instanceListers:   map[string]cache.GenericLister{},
+		brokerPodListers:  map[string]cache.GenericLister{},
+		events:            NewEventHub(logger),
+		history:           history,
+
+		configurationListers: map[string]cache.GenericLister{},
+	}
+	if client == nil {
+		return s
+	}
+
+	watched := []string{metav1.NamespaceAll}
+	if len(namespaces) > 0 {
+		watched = append([]string{}, namespaces...)
+		if !containsString(watched, flashJobNamespace) {
+			watched = append(watched, flashJobNamespace)
+		}
+	}
+	for _, namespace := range watched {
+		factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, instanceResync, namespace, nil)
+		s.informerFactories = append(s.informerFactories, factory)
+
+		if namespace == metav1.NamespaceAll || containsString(namespaces, namespace) {
+			informer := factory.ForResource(akriInstanceGVR)
+			s.instanceListers[namespace] = informer.Lister()
+			s.cacheSynced = append(s.cacheSynced, informer.Informer().HasSynced)
+			informer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+				AddFunc:    func(obj interface{}) { s.publishInstance(watch.Added, obj) },
+				UpdateFunc: s.onInstanceUpdate,
+				DeleteFunc: func(obj interface{}) { s.publishInstance(watch.Deleted, obj) },
+			})
+
+			// Broker pods get their own factory so the label selector does not
+			// leak into the instance and FlashJob informers.
+			podFactory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(client, instanceResync, namespace, func(options *metav1.ListOptions) {
+				options.LabelSelector = brokerInstanceLabel
+			})
+			s.informerFactories = append(s.informerFactories, podFactory)
+			podInformer := podFactory.ForResource(podGVR)
+			s.brokerPodListers[namespace] = podInformer.Lister()
+			s.cacheSynced = append(s.cacheSynced, podInformer.Informer().HasSynced)
+
+			configurationInformer := factory.ForResource(akriConfigurationGVR)
+			s.configurationListers[namespace] = configurationInformer.Lister()
+			s.cacheSynced = append(s.cacheSynced, configurationInformer.Informer().HasSynced)
+		}
+
+		flashJobGeneric := factory.ForResource(flashJobGVR)
+		s.flashJobListers = append(s.flashJobListers, flashJobGeneric.Lister())
+		flashJobInformer := flashJobGeneric.Informer()
+		s.cacheSynced = append(s.cacheSynced, flashJobInformer.HasSynced)
+		flashJobInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+			AddFunc:    func(obj interface{}) { s.publishFlashJob(watch.Added, obj) },
+			UpdateFunc: s.onFlashJobUpdate,
+			DeleteFunc: func(obj interface{}) { s.publishFlashJob(watch.Deleted, obj) },
+		})
+	}
+	return s
 }
 
-func (s *KubernetesService) GetAkriInstances() ([]models.AkriInstance, error) {
+// Name is the cluster name this service is registered under.
+func (s *KubernetesService) Name() string {
+	return s.name
+}
+
+// Ping checks that the cluster's API server answers with a cheap, bounded
+// list of Akri instances.
+func (s *KubernetesService) Ping(ctx context.Context) error {
+	if s.client == nil {
+		return errors.New("Kubernetes client not initialized")
+	}
+	namespace := metav1.NamespaceAll
+	if len(s.namespaces) > 0 {
+		namespace = s.namespaces[0]
+	}
+	_, err := s.client.Resource(akriInstanceGVR).Namespace(namespace).List(ctx, metav1.ListOptions{Limit: 1})
+	return err
+}
+
+// flashJobNamespaceFor validates a requested FlashJob namespace, falling back
+// to the configured default when it is empty.
+func (s *KubernetesService) flashJobNamespaceFor(namespace string) (string, error) {
+	namespace = strings.TrimSpace(namespace)
+	if namespace == "" {
+		return s.flashJobNamespace, nil
+	}
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", fmt.Errorf("%w %q: %s", ErrInvalidNamespace, namespace, strings.Join(errs, ", "))
+	}
+	return namespace, nil
+}
+
+// RolloutNamespaceFor validates the namespace a rollout asks for like
+// flashJobNamespaceFor, and also refuses namespaces the FlashJob informers
+// do not watch: status and rollout tracking would never see a FlashJob
+// created there.
+func (s *KubernetesService) RolloutNamespaceFor(namespace string) (string, error) {
+	namespace, err := s.flashJobNamespaceFor(namespace)
+	if err != nil {
+		return "", err
+	}
+	if len(s.namespaces) > 0 && namespace != s.flashJobNamespace && !containsString(s.namespaces, namespace) {
+		return "", fmt.Errorf("%w: %s", ErrNamespaceNotWatched, namespace)
+	}
+	return namespace, nil
+}
+
+// Subscribe streams Akri instance changes and FlashJob status transitions as
+// the informers observe them.
+func (s *KubernetesService) Subscribe() (<-chan models.WatchEvent, func()) {
+	return s.events.Subscribe()
+}
+
+func (s *KubernetesService) onInstanceUpdate(oldObj, newObj interface{}) {
+	oldItem, ok1 := oldObj.(*unstructured.Unstructured)
+	newItem, ok2 := newObj.(*unstructured.Unstructured)
+	// Resyncs replay unchanged objects; only forward real changes.
+	if ok1 && ok2 && oldItem.GetResourceVersion() == newItem.GetResourceVersion() {
+		return
+	}
+	s.publishInstance(watch.Modified, newObj)
+}
+
+func (s *KubernetesService) onFlashJobUpdate(oldObj, newObj interface{}) {
+	oldItem, ok1 := oldObj.(*unstructured.Unstructured)
+	newItem, ok2 := newObj.(*unstructured.Unstructured)
+	if !ok1 || !ok2 || reflect.DeepEqual(oldItem.Object["status"], newItem.Object["status"]) {
+		return
+	}
+	s.publishFlashJob(watch.Modified, newObj)
+}
+
+func (s *KubernetesService) publishInstance(eventType watch.EventType, obj interface{}) {
+	item, ok := unstructuredFromEvent(obj)
+	if !ok {
+		return
+	}
+	instance, ok := s.akriInstanceFromUnstructured(item, s.indexFlashJobs())
+	if !ok {
+		return
+	}
+	s.events.Publish(models.WatchEvent{
+		Type:      string(eventType),
+		Kind:      "AkriInstance",
+		Cluster:   s.name,
+		Object:    instance,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+func (s *KubernetesService) publishFlashJob(eventType watch.EventType, obj interface{}) {
+	item, ok := unstructuredFromEvent(obj)
+	if !ok {
+		return
+	}
+	job := flashJobFromUnstructured(s.name, item)
+	if s.history != nil && eventType != watch.Deleted {
+		s.history.RecordFlashed(s.name, job)
+	}
+	s.events.Publish(models.WatchEvent{
+		Type:      string(eventType),
+		Kind:      "FlashJob",
+		Cluster:   s.name,
+		Object:    job,
+		Timestamp: time.Now().Unix(),
+	})
+}
+
+// unstructuredFromEvent unwraps the tombstone the informer hands to delete
+// handlers when it missed the final state of an object.
+func unstructuredFromEvent(obj interface{}) (*unstructured.Unstructured, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	item, ok := obj.(*unstructured.Unstructured)
+	return item, ok
+}
+
+// Start runs the shared informers until stopCh is closed and waits for the
+// initial sync, so handlers never serve a half-filled cache.
+func (s *KubernetesService) Start(stopCh <-chan struct{}) {
+	if len(s.informerFactories) == 0 {
+		s.logger.Println("Kubernetes client is nil, not starting informers")
+		return
+	}
+	for _, factory := range s.informerFactories {
+		factory.Start(stopCh)
+	}
+	go func() {
+		if !cache.WaitForCacheSync(stopCh, s.cacheSynced...) {
+			s.logger.Println("Akri instance informers stopped before syncing")
+			return
+		}
+		s.logger.Println("Akri instance and FlashJob caches synced")
+	}()
+}
+
+func (s *KubernetesService) hasSynced() bool {
+	for _, synced := range s.cacheSynced {
+		if !synced() {
+			return false
+		}
+	}
+	return true
+}
+
+// GetAkriInstances returns the cached instances of the given namespaces. No
+// namespaces, or AllNamespaces, means every watched namespace.
+func (s *KubernetesService) GetAkriInstances(namespaces ...string) ([]models.AkriInstance, error) {
 	if s.client == nil {
 		s.logger.Println("Kubernetes client is nil, returning empty instance list")
 		return []models.AkriInstance{}, errors.New("Kubernetes client not initialized")
 	}
+	if !s.hasSynced() {
+		s.logger.Println("Akri instance cache not synced, returning empty instance list")
+		return []models.AkriInstance{}, ErrCacheNotSynced
+	}
 
-	gvr := schema.GroupVersionResource{Group: "akri.sh", Version: "v0", Resource: "instances"}
-	list, err := s.client.Resource(gvr).Namespace("default").List(context.Background(), metav1.ListOptions{})
+	objects, err := s.listCachedInstances(namespaces)
 	if err != nil {
-		s.logger.Printf("Failed to list Akri instances: %v", err)
+		s.logger.Printf("Failed to list Akri instances from cache: %v", err)
 		return []models.AkriInstance{}, err
 	}
-
-	var instances []models.AkriInstance
-	for _, item := range list.Items {
-		spec, ok := item.Object["spec"].(map[string]interface{})
+	items := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		item, ok := obj.(*unstructured.Unstructured)
 		if !ok {
-			s.logger.Printf("Skipping instance %s: spec is not a map", item.GetName())
 			continue
 		}
-		brokerProps, ok := spec["brokerProperties"].(map[string]interface{})
-		if !ok {
-			s.logger.Printf("Skipping instance %s: brokerProperties is not a map", item.GetName())
-			continue
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].GetNamespace() != items[j].GetNamespace() {
+			return items[i].GetNamespace() < items[j].GetNamespace()
 		}
-		metadata, ok := item.Object["metadata"].(map[string]interface{})
-		if !ok {
-			s.logger.Printf("Skipping instance %s: metadata is not a map", item.GetName())
-			continue
+		return items[i].GetName() < items[j].GetName()
+	})
+
+	jobs := s.indexFlashJobs()
+	var instances []models.AkriInstance
+	for _, item := range items {
+		if instance, ok := s.akriInstanceFromUnstructured(item, jobs); ok {
+			instances = append(instances, instance)
 		}
-		uuid, ok := metadata["uid"].(string)
-		if !ok {
-			s.logger.Printf("Skipping instance %s: uid is not a string", item.GetName())
-			continue
+	}
+	s.logger.Printf("Retrieved %d Akri instances", len(instances))
+	return instances, nil
+}
+
+func (s *KubernetesService) listCachedInstances(namespaces []string) ([]runtime.Object, error) {
+	var requested []string
+	for _, namespace := range namespaces {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == AllNamespaces || namespace == "*" {
+			requested = nil
+			break
 		}
-		deviceType, ok := brokerProps["DEVICE"].(string)
-		if !ok {
-			s.logger.Printf("Skipping instance %s: DEVICE is not a string", item.GetName())
+		if namespace != "" && !containsString(requested, namespace) {
+			requested = append(requested, namespace)
+		}
+	}
+
+	allLister, watchingAll := s.instanceListers[metav1.NamespaceAll]
+	if len(requested) == 0 {
+		if watchingAll {
+			return allLister.List(labels.Everything())
+		}
+		requested = s.namespaces
+	}
+
+	var objects []runtime.Object
+	for _, namespace := range requested {
+		lister, ok := s.instanceListers[namespace]
+		if watchingAll {
+			lister = allLister
+		} else if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrNamespaceNotWatched, namespace)
+		}
+		items, err := lister.ByNamespace(namespace).List(labels.Everything())
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, items...)
+	}
+	return objects, nil
+}
+
+// akriInstanceFromUnstructured maps an Akri Instance to the API model. Only
+// instances without a spec or uid are skipped; missing brokerProperties such
+// as DEVICE or APPLICATION_TYPE are left empty.
+func (s *KubernetesService) akriInstanceFromUnstructured(item *unstructured.Unstructured, jobs flashJobIndex) (models.AkriInstance, bool) {
+	if _, ok := item.Object["spec"].(map[string]interface{}); !ok {
+		s.logger.Printf("Skipping instance %s: spec is not a map", item.GetName())
+		return models.AkriInstance{}, false
+	}
+	uuid := string(item.GetUID())
+	if uuid == "" {
+		s.logger.Printf("Skipping instance %s: uid is missing", item.GetName())
+		return models.AkriInstance{}, false
+	}
+	brokerProps := brokerProperties(item)
+	firmware, version, source := s.currentFirmware(item, brokerProps)
+	creationTimestamp, _, _ := unstructured.NestedString(item.Object, "metadata", "creationTimestamp")
+	return models.AkriInstance{
+		UUID:             uuid,
+		Namespace:        item.GetNamespace(),
+		Cluster:          s.name,
+		DeviceType:       brokerProps["DEVICE"],
+		ApplicationType:  brokerProps["APPLICATION_TYPE"],
+		Status:           s.deviceStatus(item, uuid, jobs.flashing),
+		LastUpdated:      creationTimestamp,
+		BrokerProperties: brokerProps,
+		CurrentFirmware:  firmware,
+		CurrentVersion:   version,
+		FirmwareSource:   source,
+	}, true
+}
+
+// GetAkriInstance returns the full view of the cached instance with the given
+// UUID, including its broker pods.
+func (s *KubernetesService) GetAkriInstance(uuid string) (models.AkriInstanceDetail, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot get Akri instance")
+		return models.AkriInstanceDetail{}, errors.New("Kubernetes client not initialized")
+	}
+	if !s.hasSynced() {
+		return models.AkriInstanceDetail{}, ErrCacheNotSynced
+	}
+
+	objects, err := s.listCachedInstances(nil)
+	if err != nil {
+		return models.AkriInstanceDetail{}, err
+	}
+	for _, obj := range objects {
+		item, ok := obj.(*unstructured.Unstructured)
+		if !ok || string(item.GetUID()) != uuid {
 			continue
 		}
-		applicationType, ok := brokerProps["APPLICATION_TYPE"].(string)
+		instance, ok := s.akriInstanceFromUnstructured(item, s.indexFlashJobs())
 		if !ok {
-			s.logger.Printf("Skipping instance %s: APPLICATION_TYPE is not a string", item.GetName())
-			continue
+			break
 		}
-		creationTimestamp, ok := metadata["creationTimestamp"].(string)
+		return s.akriInstanceDetail(item, instance), nil
+	}
+	return models.AkriInstanceDetail{}, fmt.Errorf("%w: %s", ErrInstanceNotFound, uuid)
+}
+
+// GetAkriInstanceDetails returns the full view of every cached instance in
+// the watched namespaces.
+func (s *KubernetesService) GetAkriInstanceDetails() ([]models.AkriInstanceDetail, error) {
+	if s.client == nil {
+		return nil, errors.New("Kubernetes client not initialized")
+	}
+	if !s.hasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+	objects, err := s.listCachedInstances(nil)
+	if err != nil {
+		return nil, err
+	}
+	jobs := s.indexFlashJobs()
+	details := make([]models.AkriInstanceDetail, 0, len(objects))
+	for _, obj := range objects {
+		item, ok := obj.(*unstructured.Unstructured)
 		if !ok {
-			s.logger.Printf("Skipping instance %s: creationTimestamp is not a string", item.GetName())
 			continue
 		}
-		instances = append(instances, models.AkriInstance{
-			UUID:           uuid,
-			DeviceType:     deviceType,
-			ApplicationType: applicationType,
-			Status:         "active",
-			LastUpdated:    creationTimestamp,
-		})
+		if instance, ok := s.akriInstanceFromUnstructured(item, jobs); ok {
+			details = append(details, s.akriInstanceDetail(item, instance))
+		}
 	}
-	s.logger.Printf("Retrieved %d Akri instances", len(instances))
-	return instances, nil
+	return details, nil
 }
 
-func (s *KubernetesService) FilterInstances(instances []models.AkriInstance, uuid, deviceType, applicationType, status, lastUpdated string) []models.AkriInstance {
+func (s *KubernetesService) akriInstanceDetail(item *unstructured.Unstructured, instance models.AkriInstance) models.AkriInstanceDetail {
+	configurationName, _, _ := unstructured.NestedString(item.Object, "spec", "configurationName")
+	nodes, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "nodes")
+	shared, _, _ := unstructured.NestedBool(item.Object, "spec", "shared")
+	usage, _, _ := unstructured.NestedMap(item.Object, "spec", "deviceUsage")
+	deviceUsage := make(map[string]string, len(usage))
+	for slot, node := range usage {
+		deviceUsage[slot] = fmt.Sprint(node)
+	}
+
+	pods, _ := s.brokerPods(item.GetNamespace(), item.GetName())
+	brokerPods := make([]models.BrokerPod, 0, len(pods))
+	for _, pod := range pods {
+		brokerPods = append(brokerPods, brokerPodFromUnstructured(pod))
+	}
+	sort.Slice(brokerPods, func(i, j int) bool { return brokerPods[i].Name < brokerPods[j].Name })
+
+	if nodes == nil {
+		nodes = []string{}
+	}
+	return models.AkriInstanceDetail{
+		AkriInstance:      instance,
+		Name:              item.GetName(),
+		ConfigurationName: configurationName,
+		Nodes:             nodes,
+		Shared:            shared,
+		DeviceUsage:       deviceUsage,
+		BrokerPods:        brokerPods,
+	}
+}
+
+// brokerProperties flattens spec.brokerProperties to strings; Akri stores
+// them as strings but hand-made instances sometimes carry numbers.
+func brokerProperties(item *unstructured.Unstructured) map[string]string {
+	raw, _, _ := unstructured.NestedMap(item.Object, "spec", "brokerProperties")
+	props := make(map[string]string, len(raw))
+	for key, value := range raw {
+		if str, ok := value.(string); ok {
+			props[key] = str
+		} else {
+			props[key] = fmt.Sprint(value)
+		}
+	}
+	return props
+}
+
+// FilterInstances returns the instances matching query; see ParseQuery.
+func (s *KubernetesService) FilterInstances(instances []models.AkriInstance, query *Query) []models.AkriInstance {
 	var filtered []models.AkriInstance
 	for _, item := range instances {
-		if (uuid != "" && uuid != item.UUID) ||
-			(deviceType != "" && strings.ToLower(deviceType) != strings.ToLower(item.DeviceType)) ||
-			(applicationType != "" && strings.ToLower(applicationType) != strings.ToLower(item.ApplicationType)) ||
-			(status != "" && strings.ToLower(status) != strings.ToLower(item.Status)) ||
-			(lastUpdated != "" && lastUpdated != item.LastUpdated[:10]) {
-			continue
+		if query.Matches(item) {
+			filtered = append(filtered, item)
 		}
-		filtered = append(filtered, item)
 	}
 	s.logger.Printf("Filtered %d instances from %d total", len(filtered), len(instances))
 	return filtered
 }
 
-func (s *KubernetesService) CreateFlashJob(uuids []string, firmware, flashjobPodImage string) error {
+// rollbackLabel marks FlashJobs that restore earlier firmware, so their
+// flashes are recorded as rollbacks.
+const rollbackLabel = "flashjob.nbfc.io/rollback"
+
+// FlashJobManifest renders the FlashJob CR for spec, as written to disk and
+// submitted to the cluster.
+func FlashJobManifest(name, namespace string, spec models.FlashJobSpec) map[string]interface{} {
+	version := spec.Version
+	if version == "" {
+		version = "0.2.0"
+	}
+	metadata := map[string]interface{}{
+		"name":      name,
+		"namespace": namespace,
+	}
+	if spec.Rollback {
+		metadata["labels"] = map[string]interface{}{rollbackLabel: "true"}
+	}
+	return map[string]interface{}{
+		"apiVersion": "application.flashjob.nbfc.io/v1alpha1",
+		"kind":       "FlashJob",
+		"metadata":   metadata,
+		"spec": map[string]interface{}{
+			"applicationType":  optionalString(spec.ApplicationType),
+			"device":           optionalString(spec.Device),
+			"externalIP":       optionalString(spec.ExternalIP),
+			"firmware":         spec.Firmware,
+			"flashjobPodImage": spec.FlashjobPodImage,
+			"hostEndpoint":     optionalString(spec.HostEndpoint),
+			"uuid":             spec.UUIDs,
+			"version":          version,
+		},
+	}
+}
+
+func optionalString(value *string) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+// NewFlashJobName returns a unique name for a rollout: the first device's UUID
+// prefix keeps it recognisable, the random suffix keeps two rollouts that
+// share a first device apart.
+func NewFlashJobName(uuids []string) string {
+	prefix := "rollout"
+	if len(uuids) > 0 {
+		prefix = strings.ToLower(uuids[0])
+		if len(prefix) > 8 {
+			prefix = prefix[:8]
+		}
+	}
+	return "flashjob-" + prefix + "-" + utilrand.String(5)
+}
+
+// CreateFlashJob creates the FlashJob. An existing FlashJob of that name is
+// never overwritten: the AlreadyExists error is returned instead.
+func (s *KubernetesService) CreateFlashJob(namespace, name string, spec models.FlashJobSpec) error {
+	return s.applyFlashJob(namespace, name, "", spec, nil)
+}
+
+// ReplaceFlashJob updates an existing FlashJob, but only while it is still
+// at resourceVersion, the version the caller last saw; a change made in the
+// meantime comes back as a Conflict instead of being overwritten.
+func (s *KubernetesService) ReplaceFlashJob(namespace, name, resourceVersion string, spec models.FlashJobSpec) error {
+	return s.applyFlashJob(namespace, name, resourceVersion, spec, nil)
+}
+
+// DryRunFlashJob submits the FlashJob with server-side dry run: admission and
+// schema validation run, nothing is persisted. A resourceVersion dry-runs
+// the replacement of an existing FlashJob, as ReplaceFlashJob would.
+func (s *KubernetesService) DryRunFlashJob(namespace, name, resourceVersion string, spec models.FlashJobSpec) error {
+	return s.applyFlashJob(namespace, name, resourceVersion, spec, []string{metav1.DryRunAll})
+}
+
+// applyFlashJob creates the FlashJob, or updates it when resourceVersion is
+// set.
+func (s *KubernetesService) applyFlashJob(namespace, name, resourceVersion string, spec models.FlashJobSpec, dryRun []string) error {
 	if s.client == nil {
 		s.logger.Println("Kubernetes client is nil, cannot create FlashJob")
 		return errors.New("Kubernetes client not initialized")
 	}
+	namespace, err := s.flashJobNamespaceFor(namespace)
+	if err != nil {
+		return err
+	}
 
-	gvr := schema.GroupVersionResource{
-		Group:    "application.flashjob.nbfc.io",
-		Version:  "v1alpha1",
-		Resource: "flashjobs",
-	}
-
-	flashjob := &unstructured.Unstructured{
-		Object: map[string]interface{}{
-			"apiVersion": "application.flashjob.nbfc.io/v1alpha1",
-			"kind":       "FlashJob",
-			"metadata": map[string]interface{}{
-				"name":      "flashjob-" + uuids[0][:8],
-				"namespace": "default",
-			},
-			"spec": map[string]interface{}{
-				"applicationType":  nil,
-				"device":          nil,
-				"externalIP":      nil,
-				"firmware":        firmware,
-				"flashjobPodImage": flashjobPodImage,
-				"hostEndpoint":    nil,
-				"uuid":            uuids,
-				"version":         "0.2.0",
-			},
-		},
+	// Unstructured content must be JSON-compatible, so the UUID slice is
+	// converted to []interface{}.
+	manifest := FlashJobManifest(name, namespace, spec)
+	uuids := make([]interface{}, len(spec.UUIDs))
+	for i, uuid := range spec.UUIDs {
+		uuids[i] = uuid
 	}
+	manifest["spec"].(map[string]interface{})["uuid"] = uuids
+	flashjob := &unstructured.Unstructured{Object: manifest}
 
-	_, err := s.client.Resource(gvr).Namespace("default").Create(context.Background(), flashjob, metav1.CreateOptions{})
-	if err != nil {
-		s.logger.Printf("Failed to create FlashJob: %v", err)
-		// If resource exists, update it
-		_, err = s.client.Resource(gvr).Namespace("default").Update(context.Background(), flashjob, metav1.UpdateOptions{})
+	resource := s.client.Resource(flashJobGVR).Namespace(namespace)
+	if resourceVersion != "" {
+		flashjob.SetResourceVersion(resourceVersion)
+		_, err = resource.Update(context.Background(), flashjob, metav1.UpdateOptions{DryRun: dryRun})
 		if err != nil {
-			s.logger.Printf("Failed to update FlashJob: %v", err)
+			s.logger.Printf("Failed to update FlashJob %s: %v", name, err)
 			return err
 		}
+		s.logger.Printf("Updated FlashJob %s/%s for UUIDs: %v (dry run: %v)", namespace, name, spec.UUIDs, len(dryRun) > 0)
+		return nil
 	}
-	s.logger.Printf("Created/Updated FlashJob for UUIDs: %v", uuids)
+	_, err = resource.Create(context.Background(), flashjob, metav1.CreateOptions{DryRun: dryRun})
+	if err != nil {
+		s.logger.Printf("Failed to create FlashJob %s: %v", name, err)
+		return err
+	}
+	s.logger.Printf("Created FlashJob %s/%s for UUIDs: %v (dry run: %v)", namespace, name, spec.UUIDs, len(dryRun) > 0)
 	return nil
-}
\ No newline at end of file
+}
+
+// ListFlashJobs lists FlashJobs in one namespace, or across the cluster when
+// namespace is AllNamespaces.
+func (s *KubernetesService) ListFlashJobs(namespace, labelSelector, fieldSelector string) ([]models.FlashJob, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, returning empty FlashJob list")
+		return []models.FlashJob{}, errors.New("Kubernetes client not initialized")
+	}
+	if namespace == AllNamespaces {
+		namespace = metav1.NamespaceAll
+	} else {
+		var err error
+		if namespace, err = s.flashJobNamespaceFor(namespace); err != nil {
+			return []models.FlashJob{}, err
+		}
+	}
+
+	list, err := s.client.Resource(flashJobGVR).Namespace(namespace).List(context.Background(), metav1.ListOptions{
+		LabelSelector: labelSelector,
+		FieldSelector: fieldSelector,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to list FlashJobs: %v", err)
+		return []models.FlashJob{}, err
+	}
+
+	flashjobs := make([]models.FlashJob, 0, len(list.Items))
+	for _, item := range list.Items {
+		flashjobs = append(flashjobs, flashJobFromUnstructured(s.name, &item))
+	}
+	s.logger.Printf("Retrieved %d FlashJobs", len(flashjobs))
+	return flashjobs, nil
+}
+
+func (s *KubernetesService) GetFlashJob(namespace, name string) (models.FlashJob, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot get FlashJob")
+		return models.FlashJob{}, errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.flashJobNamespaceFor(namespace)
+	if err != nil {
+		return models.FlashJob{}, err
+	}
+
+	item, err := s.client.Resource(flashJobGVR).Namespace(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to get FlashJob %s: %v", name, err)
+		return models.FlashJob{}, err
+	}
+	return flashJobFromUnstructured(s.name, item), nil
+}
+
+// PatchFlashJob applies a JSON merge patch to the FlashJob's labels. Only
+// the labels set in patch are sent, so everything else is left as the
+// operator last saw it.
+func (s *KubernetesService) PatchFlashJob(namespace, name string, patch models.FlashJobPatch) (models.FlashJob, error) {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot patch FlashJob")
+		return models.FlashJob{}, errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.flashJobNamespaceFor(namespace)
+	if err != nil {
+		return models.FlashJob{}, err
+	}
+	if len(patch.Labels) == 0 {
+		return models.FlashJob{}, ErrEmptyPatch
+	}
+	body := map[string]interface{}{
+		"metadata": map[string]interface{}{"labels": patch.Labels},
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return models.FlashJob{}, err
+	}
+	item, err := s.client.Resource(flashJobGVR).Namespace(namespace).Patch(context.Background(), name, types.MergePatchType, data, metav1.PatchOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to patch FlashJob %s: %v", name, err)
+		return models.FlashJob{}, err
+	}
+	s.logger.Printf("Patched FlashJob %s", name)
+	return flashJobFromUnstructured(s.name, item), nil
+}
+
+func (s *KubernetesService) DeleteFlashJob(namespace, name string) error {
+	if s.client == nil {
+		s.logger.Println("Kubernetes client is nil, cannot delete FlashJob")
+		return errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.flashJobNamespaceFor(namespace)
+	if err != nil {
+		return err
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = s.client.Resource(flashJobGVR).Namespace(namespace).Delete(context.Background(), name, metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+	if err != nil {
+		s.logger.Printf("Failed to delete FlashJob %s: %v", name, err)
+		return err
+	}
+	s.logger.Printf("Deleted FlashJob %s", name)
+	return nil
+}
+
+// flashJobFromUnstructured maps a FlashJob CR to the API model. The operator
+// reports per-device progress under status.devices, either as a list of
+// {uuid, phase, error} entries or as a map keyed by UUID; devices it has not
+// reported on yet inherit the job phase, which is "Unknown" until the
+// operator writes one.
+func flashJobFromUnstructured(cluster string, item *unstructured.Unstructured) models.FlashJob {
+	uuids, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "uuid")
+	firmware, _, _ := unstructured.NestedString(item.Object, "spec", "firmware")
+	podImage, _, _ := unstructured.NestedString(item.Object, "spec", "flashjobPodImage")
+	version, _, _ := unstructured.NestedString(item.Object, "spec", "version")
+	phase, _, _ := unstructured.NestedString(item.Object, "status", "phase")
+	message, _, _ := unstructured.NestedString(item.Object, "status", "message")
+	if phase == "" {
+		phase = phaseUnknown
+	}
+
+	reported := map[string]models.DeviceStatus{}
+	if status, ok := item.Object["status"].(map[string]interface{}); ok {
+		switch entries := status["devices"].(type) {
+		case []interface{}:
+			for _, entry := range entries {
+				if m, ok := entry.(map[string]interface{}); ok {
+					d := deviceStatusFromMap(m)
+					reported[d.UUID] = d
+				}
+			}
+		case map[string]interface{}:
+			for uuid, entry := range entries {
+				if m, ok := entry.(map[string]interface{}); ok {
+					d := deviceStatusFromMap(m)
+					d.UUID = uuid
+					reported[uuid] = d
+				}
+			}
+		}
+	}
+
+	statuses := make([]models.DeviceStatus, 0, len(uuids))
+	for _, uuid := range uuids {
+		d, ok := reported[uuid]
+		if !ok || d.Phase == "" {
+			d.UUID = uuid
+			d.Phase = phase
+		}
+		statuses = append(statuses, d)
+	}
+
+	return models.FlashJob{
+		Name:             item.GetName(),
+		Namespace:        item.GetNamespace(),
+		Cluster:          cluster,
+		UUIDs:            uuids,
+		Firmware:         firmware,
+		FlashjobPodImage: podImage,
+		Version:          version,
+		CreatedAt:        item.GetCreationTimestamp().UTC().Format(time.RFC3339),
+		Rollback:         item.GetLabels()[rollbackLabel] == "true",
+		Status: models.FlashJobStatus{
+			Phase:   phase,
+			Message: message,
+			Devices: statuses,
+		},
+	}
+}
+
+func deviceStatusFromMap(m map[string]interface{}) models.DeviceStatus {
+	d := models.DeviceStatus{}
+	d.UUID, _ = m["uuid"].(string)
+	d.Phase, _ = m["phase"].(string)
+	d.Error, _ = m["error"].(string)
+	if d.Error == "" {
+		d.Error, _ = m["message"].(string)
+	}
+	return d
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+var ErrInvalidPage = errors.New("invalid page request")
+
+// Page sizes for instance listings: the default when no limit is given, and
+// the largest limit accepted.
+const (
+	DefaultPageLimit = 100
+	MaxPageLimit     = 1000
+)
+
+// PageRequest selects one page of an instance listing. Sort is a comma
+// separated list of fields (any query field, see ParseQuery), each
+// optionally prefixed with "-" for descending; ties are broken by cluster
+// and UUID so pages are stable. Cursor is the NextCursor of the previous
+// page, which must have used the same Sort.
+type PageRequest struct {
+	Sort   string
+	Cursor string
+	Limit  int
+	Fields []string
+}
+
+// InstancePage is one page of a listing. Total counts every instance that
+// matched, across all pages; NextCursor is empty on the last page.
+type InstancePage struct {
+	Instances  []models.AkriInstance
+	Total      int
+	NextCursor string
+}
+
+type sortKey struct {
+	field      string
+	descending bool
+	kind       sortKind
+}
+
+// sortKind is how the values of a sort key compare. It is picked once per
+// listing from all of the key's values, so that every pair of instances is
+// ordered the same way and the order stays transitive.
+type sortKind int
+
+const (
+	sortStrings sortKind = iota
+	sortNumbers
+	sortVersions
+	sortTimes
+)
+
+// pageCursor is the sort position of the last instance of a page. Keying on
+// values rather than an offset keeps pages from skipping or repeating
+// instances when the list changes in between.
+type pageCursor struct {
+	Sort    string   `json:"s"`
+	Values  []string `json:"v"`
+	Cluster string   `json:"c"`
+	UUID    string   `json:"u"`
+}
+
+// PaginateInstances sorts instances and returns the page req selects.
+func PaginateInstances(instances []models.AkriInstance, req PageRequest) (InstancePage, error) {
+	keys, err := parseSortKeys(req.Sort)
+	if err != nil {
+		return InstancePage{}, err
+	}
+	for i := range keys {
+		keys[i].kind = sortKindOf(instances, keys[i].field)
+	}
+	limit := req.Limit
+	switch {
+	case limit == 0:
+		limit = DefaultPageLimit
+	case limit < 0 || limit > MaxPageLimit:
+		return InstancePage{}, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidPage, MaxPageLimit)
+	}
+
+	sorted := append([]models.AkriInstance(nil), instances...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareInstances(sorted[i], sortValues(sorted[j], keys), sorted[j].Cluster, sorted[j].UUID, keys) < 0
+	})
+
+	start := 0
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return InstancePage{}, err
+		}
+		if cursor.Sort != req.Sort || len(cursor.Values) != len(keys) {
+			return InstancePage{}, fmt.Errorf("%w: cursor belongs to a listing sorted by %q", ErrInvalidPage, cursor.Sort)
+		}
+		start = sort.Search(len(sorted), func(i int) bool {
+			return compareInstances(sorted[i], cursor.Values, cursor.Cluster, cursor.UUID, keys) > 0
+		})
+	}
+	end := min(start+limit, len(sorted))
+
+	page := InstancePage{Instances: sorted[start:end], Total: len(sorted)}
+	if end < len(sorted) {
+		last := sorted[end-1]
+		page.NextCursor = encodeCursor(pageCursor{Sort: req.Sort, Values: sortValues(last, keys), Cluster: last.Cluster, UUID: last.UUID})
+	}
+	return page, nil
+}
+
+func parseSortKeys(spec string) ([]sortKey, error) {
+	var keys []sortKey
+	for _, field := range strings.Split(spec, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		key := sortKey{field: strings.TrimPrefix(field, "-"), descending: strings.HasPrefix(field, "-")}
+		if key.field == "" || strings.ContainsAny(key.field, " ()=!<>^~\"") {
+			return nil, fmt.Errorf("%w: invalid sort field %q", ErrInvalidPage, field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func sortValues(instance models.AkriInstance, keys []sortKey) []string {
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = queryField(instance, key.field)
+	}
+	return values
+}
+
+// compareInstances orders instance against the position given by values,
+// cluster and uuid. Empty values sort last whichever the direction.
+func compareInstances(instance models.AkriInstance, values []string, cluster, uuid string, keys []sortKey) int {
+	for i, key := range keys {
+		a, b := queryField(instance, key.field), values[i]
+		var order int
+		switch {
+		case a == b:
+			continue
+		case a == "":
+			return 1
+		case b == "":
+			return -1
+		default:
+			order = compareSortValues(a, b, key.kind)
+		}
+		if order == 0 {
+			continue
+		}
+		if key.descending {
+			order = -order
+		}
+		return order
+	}
+	if c := strings.Compare(instance.Cluster, cluster); c != 0 {
+		return c
+	}
+	return strings.Compare(instance.UUID, uuid)
+}
+
+// sortKindOf picks the most specific kind every non-empty value of field
+// parses as: times, then versions, then numbers, else strings.
+func sortKindOf(instances []models.AkriInstance, field string) sortKind {
+	times, versions, numbers, seen := true, true, true, false
+	for _, instance := range instances {
+		value := queryField(instance, field)
+		if value == "" {
+			continue
+		}
+		seen = true
+		if _, ok := parseQueryTime(value); !ok {
+			times = false
+		}
+		if _, ok := parseQueryVersion(value); !ok {
+			versions = false
+		}
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			numbers = false
+		}
+	}
+	switch {
+	case !seen:
+		return sortStrings
+	case times:
+		return sortTimes
+	case versions:
+		return sortVersions
+	case numbers:
+		return sortNumbers
+	}
+	return sortStrings
+}
+
+// compareSortValues orders a and b as kind, falling back to their text so
+// two different values never compare equal and the order stays total. A
+// value that does not parse as kind, such as one from the cursor of an
+// older listing, sorts as the zero value.
+func compareSortValues(a, b string, kind sortKind) int {
+	order := 0
+	switch kind {
+	case sortTimes:
+		ta, _ := parseQueryTime(a)
+		tb, _ := parseQueryTime(b)
+		order = ta.Compare(tb)
+	case sortVersions:
+		va, _ := parseQueryVersion(a)
+		vb, _ := parseQueryVersion(b)
+		order = compareVersions(va, vb)
+	case sortNumbers:
+		na, _ := strconv.ParseFloat(a, 64)
+		nb, _ := strconv.ParseFloat(b, 64)
+		order = cmp.Compare(na, nb)
+	}
+	if order != 0 {
+		return order
+	}
+	if order = strings.Compare(strings.ToLower(a), strings.ToLower(b)); order != 0 {
+		return order
+	}
+	return strings.Compare(a, b)
+}
+
+func encodeCursor(cursor pageCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err == nil {
+		err = json.Unmarshal(data, &cursor)
+	}
+	if err != nil {
+		return pageCursor{}, fmt.Errorf("%w: malformed cursor", ErrInvalidPage)
+	}
+	return cursor, nil
+}
+
+// SelectFields renders each instance with only the given JSON fields.
+// "brokerProperties.KEY" picks a single broker property. No fields keeps
+// whole instances.
+func SelectFields(instances []models.AkriInstance, fields []string) ([]interface{}, error) {
+	out := make([]interface{}, 0, len(instances))
+	if len(fields) == 0 {
+		for _, instance := range instances {
+			out = append(out, instance)
+		}
+		return out, nil
+	}
+
+	known, err := instanceFields(models.AkriInstance{})
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range fields {
+		name, _, _ := strings.Cut(field, ".")
+		if _, ok := known[name]; !ok || (name != field && name != "brokerProperties") {
+			return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidPage, field)
+		}
+	}
+	for _, instance := range instances {
+		all, err := instanceFields(instance)
+		if err != nil {
+			return nil, err
+		}
+		selected := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if key, ok := strings.CutPrefix(field, "brokerProperties."); ok {
+				if _, whole := selected["brokerProperties"].(json.RawMessage); whole {
+					continue
+				}
+				props, _ := selected["brokerProperties"].(map[string]string)
+				if props == nil {
+					props = map[string]string{}
+					selected["brokerProperties"] = props
+				}
+				if value, ok := instance.BrokerProperties[key]; ok {
+					props[key] = value
+				}
+				continue
+			}
+			selected[field] = all[field]
+		}
+		out = append(out, selected)
+	}
+	return out, nil
+}
+
+// instanceFields is instance as a JSON object, so field selection follows
+// the JSON names and picks up new fields without changes here.
+func instanceFields(instance models.AkriInstance) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(instance)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(data, &fields)
+	return fields, err
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+func pageInstances(values ...string) []models.AkriInstance {
+	instances := make([]models.AkriInstance, len(values))
+	for i, value := range values {
+		instances[i] = models.AkriInstance{
+			UUID:             fmt.Sprintf("u%02d", i),
+			Cluster:          "default",
+			BrokerProperties: map[string]string{"V": value},
+		}
+	}
+	return instances
+}
+
+func instanceValues(instances []models.AkriInstance) []string {
+	values := make([]string, len(instances))
+	for i, instance := range instances {
+		values[i] = instance.BrokerProperties["V"]
+	}
+	return values
+}
+
+func TestPaginateInstancesSorts(t *testing.T) {
+	tests := []struct {
+		name   string
+		sort   string
+		values []string
+		want   []string
+	}{
+		{"numbers", "V", []string{"10", "9", "100", "1.5"}, []string{"1.5", "9", "10", "100"}},
+		{"versions", "V", []string{"0.10.0", "0.9.1", "v1.0", "0.9.10"}, []string{"0.9.1", "0.9.10", "0.10.0", "v1.0"}},
+		{"times", "V", []string{"2025-07-02", "2025-07-01T12:00:00Z", "2024-12-31T23:59:59Z"}, []string{"2024-12-31T23:59:59Z", "2025-07-01T12:00:00Z", "2025-07-02"}},
+		{"mixed values sort as strings", "V", []string{"abc", "10", "1.2", "9"}, []string{"1.2", "10", "9", "abc"}},
+		{"case-insensitive strings", "V", []string{"beta", "Alpha", "alpha", "Beta"}, []string{"Alpha", "alpha", "Beta", "beta"}},
+		{"descending", "-V", []string{"1", "3", "2"}, []string{"3", "2", "1"}},
+		{"empty values last", "V", []string{"", "2", "1"}, []string{"1", "2", ""}},
+		{"empty values last when descending", "-V", []string{"", "2", "1"}, []string{"2", "1", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := PaginateInstances(pageInstances(tt.values...), PageRequest{Sort: tt.sort})
+			if err != nil {
+				t.Fatalf("PaginateInstances: %v", err)
+			}
+			if got := instanceValues(page.Instances); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sorted by %s = %q, want %q", tt.sort, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPaginateInstancesCursorWalk(t *testing.T) {
+	values := []string{"1.2", "10", "abc", "9", "1.2", "", "v2", "10", "B", "b", "a"}
+	for _, sort := range []string{"V", "-V", "V,uuid"} {
+		for _, limit := range []int{1, 2, 3, 20} {
+			t.Run(fmt.Sprintf("%s/limit %d", sort, limit), func(t *testing.T) {
+				instances := pageInstances(values...)
+				all, err := PaginateInstances(instances, PageRequest{Sort: sort, Limit: len(instances)})
+				if err != nil {
+					t.Fatalf("PaginateInstances: %v", err)
+				}
+				var walked []models.AkriInstance
+				cursor := ""
+				for pages := 0; ; pages++ {
+					if pages > len(instances) {
+						t.Fatal("cursor walk does not end")
+					}
+					page, err := PaginateInstances(instances, PageRequest{Sort: sort, Cursor: cursor, Limit: limit})
+					if err != nil {
+						t.Fatalf("PaginateInstances: %v", err)
+					}
+					if page.Total != len(instances) {
+						t.Errorf("Total = %d, want %d", page.Total, len(instances))
+					}
+					walked = append(walked, page.Instances...)
+					if page.NextCursor == "" {
+						break
+					}
+					cursor = page.NextCursor
+				}
+				if !reflect.DeepEqual(walked, all.Instances) {
+					t.Errorf("pages walked %q, want %q", instanceValues(walked), instanceValues(all.Instances))
+				}
+			})
+		}
+	}
+}
+
+func TestPaginateInstancesErrors(t *testing.T) {
+	instances := pageInstances("1", "2", "3")
+	first, err := PaginateInstances(instances, PageRequest{Sort: "V", Limit: 1})
+	if err != nil {
+		t.Fatalf("PaginateInstances: %v", err)
+	}
+	tests := []struct {
+		name string
+		req  PageRequest
+	}{
+		{"negative limit", PageRequest{Limit: -1}},
+		{"limit too large", PageRequest{Limit: MaxPageLimit + 1}},
+		{"invalid sort field", PageRequest{Sort: "a b"}},
+		{"bare minus", PageRequest{Sort: "-"}},
+		{"malformed cursor", PageRequest{Cursor: "not a cursor"}},
+		{"cursor of another sort", PageRequest{Sort: "-V", Cursor: first.NextCursor}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := PaginateInstances(instances, tt.req); !errors.Is(err, ErrInvalidPage) {
+				t.Errorf("PaginateInstances error = %v, want ErrInvalidPage", err)
+			}
+		})
+	}
+}
+
+func TestCompareSortValuesIsTransitive(t *testing.T) {
+	values := []string{"1.2", "10", "abc", "9", "v2", "2025-07-01", "B", "b"}
+	for _, kind := range []sortKind{sortStrings, sortNumbers, sortVersions, sortTimes} {
+		for _, a := range values {
+			for _, b := range values {
+				ab := compareSortValues(a, b, kind)
+				if ab != -compareSortValues(b, a, kind) {
+					t.Errorf("kind %d: compare(%q, %q) is not antisymmetric", kind, a, b)
+				}
+				if (ab == 0) != (a == b) {
+					t.Errorf("kind %d: compare(%q, %q) = 0 for different values", kind, a, b)
+				}
+				for _, c := range values {
+					if ab < 0 && compareSortValues(b, c, kind) < 0 && compareSortValues(a, c, kind) >= 0 {
+						t.Errorf("kind %d: %q < %q < %q but not %q < %q", kind, a, b, c, a, c)
+					}
+				}
+			}
+		}
+	}
+}
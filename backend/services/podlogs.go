@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+var ErrNoFlashJobPods = errors.New("no pods found for FlashJob")
+
+// LogOptions selects what PodLogs returns, as kubectl logs does.
+type LogOptions struct {
+	Container  string
+	Follow     bool
+	TailLines  *int64
+	Timestamps bool
+}
+
+// FlashJobPods returns the pods the operator started for the FlashJob,
+// oldest first: the pods of the Jobs the FlashJob owns. Ownership is only
+// followed through ownerReferences, and each Job's pods are fetched with its
+// own pod selector. With uuid set, only pods working on that device are
+// kept.
+func (s *KubernetesService) FlashJobPods(namespace, name, uuid string) ([]models.FlashJobPod, error) {
+	if s.client == nil || s.typed == nil {
+		return nil, errors.New("Kubernetes client not initialized")
+	}
+	namespace, err := s.flashJobNamespaceFor(namespace)
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	item, err := s.client.Resource(flashJobGVR).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	uuids, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "uuid")
+
+	jobs, err := s.typed.BatchV1().Jobs(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	var result []models.FlashJobPod
+	for _, job := range jobs.Items {
+		if !ownedBy(job.OwnerReferences, item.GetUID()) || job.Spec.Selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(job.Spec.Selector)
+		if err != nil {
+			s.logger.Printf("Skipping Job %s of FlashJob %s with an invalid selector: %v", job.Name, name, err)
+			continue
+		}
+		pods, err := s.typed.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector.String()})
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods.Items {
+			if !ownedBy(pod.OwnerReferences, job.UID) {
+				continue
+			}
+			flashJobPod := flashJobPodFrom(pod, uuids)
+			if uuid != "" && !containsString(flashJobPod.UUIDs, uuid) {
+				continue
+			}
+			result = append(result, flashJobPod)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].StartTime != result[j].StartTime {
+			return result[i].StartTime < result[j].StartTime
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// PodLogs opens the log stream of one container of a pod. The caller closes
+// it; with Follow set it stays open until ctx is done or the container exits.
+func (s *KubernetesService) PodLogs(ctx context.Context, namespace, pod string, opts LogOptions) (io.ReadCloser, error) {
+	if s.typed == nil {
+		return nil, errors.New("Kubernetes client not initialized")
+	}
+	request := s.typed.CoreV1().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{
+		Container:  opts.Container,
+		Follow:     opts.Follow,
+		TailLines:  opts.TailLines,
+		Timestamps: opts.Timestamps,
+	})
+	stream, err := request.Stream(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("logs of %s/%s: %w", pod, opts.Container, err)
+	}
+	return stream, nil
+}
+
+// flashJobPodFrom summarises pod. Which of uuids it works on is read from
+// its labels, annotations, environment and arguments; a FlashJob with a
+// single device runs every pod for that device.
+func flashJobPodFrom(pod corev1.Pod, uuids []string) models.FlashJobPod {
+	result := models.FlashJobPod{
+		Name:      pod.Name,
+		Namespace: pod.Namespace,
+		Phase:     string(pod.Status.Phase),
+		NodeName:  pod.Spec.NodeName,
+		UUIDs:     []string{},
+	}
+	if pod.Status.StartTime != nil {
+		result.StartTime = pod.Status.StartTime.UTC().Format(time.RFC3339)
+	}
+
+	var mentions []string
+	for _, value := range pod.Labels {
+		mentions = append(mentions, value)
+	}
+	for _, value := range pod.Annotations {
+		mentions = append(mentions, value)
+	}
+	containers := append(append([]corev1.Container{}, pod.Spec.InitContainers...), pod.Spec.Containers...)
+	for _, container := range containers {
+		result.Containers = append(result.Containers, container.Name)
+		mentions = append(mentions, container.Args...)
+		mentions = append(mentions, container.Command...)
+		for _, env := range container.Env {
+			mentions = append(mentions, env.Value)
+		}
+	}
+	for _, uuid := range uuids {
+		if len(uuids) == 1 || mentionsValue(mentions, uuid) {
+			result.UUIDs = append(result.UUIDs, uuid)
+		}
+	}
+	return result
+}
+
+func ownedBy(references []metav1.OwnerReference, owner types.UID) bool {
+	for _, reference := range references {
+		if reference.UID == owner {
+			return true
+		}
+	}
+	return false
+}
+
+func mentionsValue(values []string, value string) bool {
+	for _, v := range values {
+		if strings.Contains(v, value) {
+			return true
+		}
+	}
+	return false
+}
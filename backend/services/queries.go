@@ -0,0 +1,124 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	ErrQueryNotFound = errors.New("saved query not found")
+	ErrQueryExists   = errors.New("saved query already exists")
+)
+
+// savedQueriesKey is the Redis hash holding saved queries as JSON, keyed by
+// name.
+const savedQueriesKey = "saved-queries"
+
+// SavedQueries stores named instance filter queries.
+type SavedQueries struct {
+	mu     sync.Mutex
+	redis  *RedisService
+	logger *log.Logger
+}
+
+func NewSavedQueries(redis *RedisService, logger *log.Logger) *SavedQueries {
+	return &SavedQueries{redis: redis, logger: logger}
+}
+
+func (q *SavedQueries) List() ([]models.SavedQuery, error) {
+	values, err := q.redis.HGetAllValues(savedQueriesKey)
+	if err != nil {
+		return nil, err
+	}
+	queries := make([]models.SavedQuery, 0, len(values))
+	for name, value := range values {
+		var query models.SavedQuery
+		if err := json.Unmarshal([]byte(value), &query); err != nil {
+			q.logger.Printf("Skipping unreadable saved query %s: %v", name, err)
+			continue
+		}
+		queries = append(queries, query)
+	}
+	sort.Slice(queries, func(i, j int) bool { return queries[i].Name < queries[j].Name })
+	return queries, nil
+}
+
+func (q *SavedQueries) Get(name string) (models.SavedQuery, error) {
+	var query models.SavedQuery
+	found, err := q.redis.HGetValue(savedQueriesKey, name, &query)
+	if err != nil {
+		return models.SavedQuery{}, err
+	}
+	if !found {
+		return models.SavedQuery{}, fmt.Errorf("%w: %s", ErrQueryNotFound, name)
+	}
+	return query, nil
+}
+
+// Parse returns the parsed query saved under name.
+func (q *SavedQueries) Parse(name string) (*Query, error) {
+	saved, err := q.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return ParseQuery(saved.Query)
+}
+
+// Save creates the query, or replaces it when update is set.
+func (q *SavedQueries) Save(query models.SavedQuery, update bool) (models.SavedQuery, error) {
+	query.Name = strings.TrimSpace(query.Name)
+	query.Query = strings.TrimSpace(query.Query)
+	if errs := validation.IsDNS1123Label(query.Name); len(errs) > 0 {
+		return models.SavedQuery{}, fmt.Errorf("%w: name %q: %s", ErrInvalidQuery, query.Name, strings.Join(errs, ", "))
+	}
+	if query.Query == "" {
+		return models.SavedQuery{}, fmt.Errorf("%w: query is required", ErrInvalidQuery)
+	}
+	if _, err := ParseQuery(query.Query); err != nil {
+		return models.SavedQuery{}, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	existing, err := q.Get(query.Name)
+	switch {
+	case err == nil && !update:
+		return models.SavedQuery{}, fmt.Errorf("%w: %s", ErrQueryExists, query.Name)
+	case errors.Is(err, ErrQueryNotFound) && update:
+		return models.SavedQuery{}, err
+	case err != nil && !errors.Is(err, ErrQueryNotFound):
+		return models.SavedQuery{}, err
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	query.CreatedAt = existing.CreatedAt
+	if query.CreatedAt == "" {
+		query.CreatedAt = now
+	}
+	if existing.CreatedBy != "" {
+		query.CreatedBy = existing.CreatedBy
+	}
+	query.UpdatedAt = now
+	if err := q.redis.HSetValue(savedQueriesKey, query.Name, query); err != nil {
+		return models.SavedQuery{}, err
+	}
+	q.logger.Printf("Saved query %s: %s", query.Name, query.Query)
+	return query, nil
+}
+
+func (q *SavedQueries) Delete(name string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if _, err := q.Get(name); err != nil {
+		return err
+	}
+	return q.redis.HDelete(savedQueriesKey, name)
+}
@@ -0,0 +1,521 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Query is a parsed instance filter such as
+//
+//	deviceType in (esp32, esp32s3) AND NOT status = flashing
+//	(site ^= plant- OR FIRMWARE =~ "^v2\.") AND lastUpdated >= 2025-07-01
+//
+// Terms compare a field with a value and combine with AND, OR, NOT and
+// parentheses; AND binds tighter than OR. Fields are the instance fields
+// (uuid, namespace, cluster, deviceType, applicationType, status,
+// lastUpdated, currentFirmware, currentVersion, firmwareSource) or any
+// brokerProperties key, optionally written as
+// brokerProperties.KEY. Operators:
+//
+//	=  !=            case-insensitive equality
+//	in (a, b)        equal to any listed value; "not in" negates
+//	^=               case-insensitive prefix
+//	=~  !~           regular expression (RE2, case-sensitive unless (?i))
+//	>  >=  <  <=     ordering: as times when both sides are dates, as
+//	                 numbers when both are numeric, as versions when both
+//	                 are dotted versions (0.1.1 < 0.10.0), else as strings
+//
+// A date without a time (2025-07-01) stands for the whole UTC day, so
+// "lastUpdated = 2025-07-01" matches anything that day and
+// "lastUpdated > 2025-07-01" anything from the next day on. Values are bare
+// words or double-quoted strings with Go escapes.
+type Query struct {
+	text string
+	root queryNode
+}
+
+func (q *Query) String() string {
+	return q.text
+}
+
+// Matches reports whether instance satisfies the query. A nil query matches
+// everything.
+func (q *Query) Matches(instance models.AkriInstance) bool {
+	if q == nil || q.root == nil {
+		return true
+	}
+	return q.root.matches(instance)
+}
+
+// ParseQuery parses text; an empty query matches every instance.
+func ParseQuery(text string) (*Query, error) {
+	tokens, err := lexQuery(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &queryParser{tokens: tokens}
+	query := &Query{text: strings.TrimSpace(text)}
+	if len(tokens) == 0 {
+		return query, nil
+	}
+	if query.root, err = p.parseOr(); err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+	return query, nil
+}
+
+// AndQueries joins the non-empty queries with AND.
+func AndQueries(queries ...*Query) *Query {
+	var joined *Query
+	for _, query := range queries {
+		if query == nil || query.root == nil {
+			continue
+		}
+		if joined == nil {
+			joined = query
+			continue
+		}
+		joined = &Query{
+			text: "(" + joined.text + ") AND (" + query.text + ")",
+			root: andNode{joined.root, query.root},
+		}
+	}
+	return joined
+}
+
+// QuoteQueryValue quotes value for use on the right of a query operator.
+func QuoteQueryValue(value string) string {
+	return strconv.Quote(value)
+}
+
+type queryNode interface {
+	matches(instance models.AkriInstance) bool
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ node queryNode }
+
+func (n andNode) matches(i models.AkriInstance) bool { return n.left.matches(i) && n.right.matches(i) }
+func (n orNode) matches(i models.AkriInstance) bool  { return n.left.matches(i) || n.right.matches(i) }
+func (n notNode) matches(i models.AkriInstance) bool { return !n.node.matches(i) }
+
+type comparisonNode struct {
+	field  string
+	op     string
+	values []string
+	regex  *regexp.Regexp
+}
+
+func (n comparisonNode) matches(instance models.AkriInstance) bool {
+	actual := queryField(instance, n.field)
+	switch n.op {
+	case "=":
+		return equalValues(actual, n.values[0])
+	case "!=":
+		return !equalValues(actual, n.values[0])
+	case "in", "not in":
+		found := false
+		for _, value := range n.values {
+			if equalValues(actual, value) {
+				found = true
+				break
+			}
+		}
+		return found == (n.op == "in")
+	case "^=":
+		return strings.HasPrefix(strings.ToLower(actual), strings.ToLower(n.values[0]))
+	case "=~":
+		return n.regex.MatchString(actual)
+	case "!~":
+		return !n.regex.MatchString(actual)
+	}
+	if actual == "" {
+		return false
+	}
+	cmp := compareValues(actual, n.values[0])
+	switch n.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// queryField reads a named instance field, falling back to the broker
+// property of that name, matched exactly and then case-insensitively.
+func queryField(instance models.AkriInstance, field string) string {
+	if key, ok := strings.CutPrefix(field, "brokerProperties."); ok {
+		return brokerProperty(instance.BrokerProperties, key)
+	}
+	switch strings.ToLower(field) {
+	case "uuid":
+		return instance.UUID
+	case "namespace":
+		return instance.Namespace
+	case "cluster":
+		return instance.Cluster
+	case "devicetype":
+		return instance.DeviceType
+	case "applicationtype":
+		return instance.ApplicationType
+	case "status":
+		return instance.Status
+	case "lastupdated":
+		return instance.LastUpdated
+	case "currentfirmware":
+		return instance.CurrentFirmware
+	case "currentversion":
+		return instance.CurrentVersion
+	case "firmwaresource":
+		return instance.FirmwareSource
+	}
+	return brokerProperty(instance.BrokerProperties, field)
+}
+
+func brokerProperty(props map[string]string, key string) string {
+	if value, ok := props[key]; ok {
+		return value
+	}
+	for name, value := range props {
+		if strings.EqualFold(name, key) {
+			return value
+		}
+	}
+	return ""
+}
+
+// equalValues compares case-insensitively; a bare date on the right matches
+// any time that day.
+func equalValues(actual, expected string) bool {
+	if day, ok := parseQueryDay(expected); ok {
+		if t, ok := parseQueryTime(actual); ok {
+			return !t.Before(day) && t.Before(day.AddDate(0, 0, 1))
+		}
+	}
+	return strings.EqualFold(actual, expected)
+}
+
+// compareValues orders actual against expected as times, numbers or
+// strings. A bare date compares as its whole day: a time within it is equal.
+func compareValues(actual, expected string) int {
+	if t, ok := parseQueryTime(actual); ok {
+		if day, ok := parseQueryDay(expected); ok {
+			switch {
+			case t.Before(day):
+				return -1
+			case t.Before(day.AddDate(0, 0, 1)):
+				return 0
+			}
+			return 1
+		}
+		if other, ok := parseQueryTime(expected); ok {
+			return t.Compare(other)
+		}
+	}
+	if a, ok := parseQueryVersion(actual); ok {
+		if b, ok := parseQueryVersion(expected); ok {
+			return compareVersions(a, b)
+		}
+	}
+	if a, err := strconv.ParseFloat(actual, 64); err == nil {
+		if b, err := strconv.ParseFloat(expected, 64); err == nil {
+			switch {
+			case a < b:
+				return -1
+			case a > b:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(strings.ToLower(actual), strings.ToLower(expected))
+}
+
+func parseQueryDay(value string) (time.Time, bool) {
+	day, err := time.Parse(time.DateOnly, value)
+	return day, err == nil
+}
+
+func parseQueryTime(value string) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, true
+	}
+	return parseQueryDay(value)
+}
+
+// parseQueryVersion reads a dotted version such as 0.1.1 or v2.3 (at least
+// two parts, so plain numbers still compare as numbers).
+func parseQueryVersion(value string) ([]int, bool) {
+	parts := strings.Split(strings.TrimPrefix(value, "v"), ".")
+	if len(parts) < 2 {
+		return nil, false
+	}
+	version := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, false
+		}
+		version[i] = n
+	}
+	return version, true
+}
+
+// compareVersions compares part by part, missing parts counting as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+type queryToken struct {
+	text   string
+	quoted bool
+}
+
+// lexQuery splits text into words, quoted strings, parentheses, commas and
+// operators.
+func lexQuery(text string) ([]queryToken, error) {
+	var tokens []queryToken
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		switch {
+		case unicode.IsSpace(r):
+			i += size
+		case r == '(' || r == ')' || r == ',':
+			tokens = append(tokens, queryToken{text: string(r)})
+			i++
+		case r == '"':
+			end := i + 1
+			for end < len(text) && text[end] != '"' {
+				if text[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(text) {
+				return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidQuery, i)
+			}
+			value, err := strconv.Unquote(text[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("%w: string at %d: %v", ErrInvalidQuery, i, err)
+			}
+			tokens = append(tokens, queryToken{text: value, quoted: true})
+			i = end + 1
+		case strings.ContainsRune("=!<>^~", r):
+			end := i + 1
+			if end < len(text) && strings.ContainsRune("=~", rune(text[end])) {
+				end++
+			}
+			tokens = append(tokens, queryToken{text: text[i:end]})
+			i = end
+		default:
+			end := i
+			for end < len(text) {
+				r, size := utf8.DecodeRuneInString(text[end:])
+				if unicode.IsSpace(r) || strings.ContainsRune(`(),"=!<>^~`, r) {
+					break
+				}
+				end += size
+			}
+			tokens = append(tokens, queryToken{text: text[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+// keyword reports whether the next token is the unquoted word, and consumes
+// it if so.
+func (p *queryParser) keyword(word string) bool {
+	if p.pos < len(p.tokens) && !p.tokens[p.pos].quoted && strings.EqualFold(p.tokens[p.pos].text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) next(what string) (queryToken, error) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, fmt.Errorf("%w: expected %s at end of query", ErrInvalidQuery, what)
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryNode, error) {
+	if p.keyword("not") {
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{node}, nil
+	}
+	if p.keyword("(") {
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.keyword(")") {
+			return nil, fmt.Errorf("%w: missing )", ErrInvalidQuery)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	field, err := p.next("a field")
+	if err != nil {
+		return nil, err
+	}
+	if field.quoted || strings.ContainsAny(field.text, "(),=!<>^~") || isQueryKeyword(field.text) {
+		return nil, fmt.Errorf("%w: expected a field, got %q", ErrInvalidQuery, field.text)
+	}
+	node := comparisonNode{field: field.text}
+
+	switch {
+	case p.keyword("in"):
+		node.op = "in"
+	case p.keyword("not"):
+		if !p.keyword("in") {
+			return nil, fmt.Errorf("%w: expected in after %s not", ErrInvalidQuery, field.text)
+		}
+		node.op = "not in"
+	default:
+		op, err := p.next("an operator")
+		if err != nil {
+			return nil, err
+		}
+		switch op.text {
+		case "=", "==":
+			node.op = "="
+		case "!=", ">", ">=", "<", "<=", "^=", "=~", "!~":
+			node.op = op.text
+		default:
+			return nil, fmt.Errorf("%w: unknown operator %q after %s", ErrInvalidQuery, op.text, field.text)
+		}
+		if op.quoted {
+			return nil, fmt.Errorf("%w: expected an operator after %s", ErrInvalidQuery, field.text)
+		}
+	}
+
+	if node.op == "in" || node.op == "not in" {
+		if !p.keyword("(") {
+			return nil, fmt.Errorf("%w: expected ( after %s %s", ErrInvalidQuery, field.text, node.op)
+		}
+		for {
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			node.values = append(node.values, value)
+			if p.keyword(")") {
+				break
+			}
+			if !p.keyword(",") {
+				return nil, fmt.Errorf("%w: expected , or ) in %s list", ErrInvalidQuery, field.text)
+			}
+		}
+		return node, nil
+	}
+
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	node.values = []string{value}
+	if node.op == "=~" || node.op == "!~" {
+		if node.regex, err = regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("%w: regular expression %q: %v", ErrInvalidQuery, value, err)
+		}
+	}
+	return node, nil
+}
+
+func (p *queryParser) value() (string, error) {
+	token, err := p.next("a value")
+	if err != nil {
+		return "", err
+	}
+	if !token.quoted && (strings.ContainsAny(token.text, "(),=!<>^~") || isQueryKeyword(token.text)) {
+		return "", fmt.Errorf("%w: expected a value, got %q (quote it if meant literally)", ErrInvalidQuery, token.text)
+	}
+	return token.text, nil
+}
+
+func isQueryKeyword(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not", "in":
+		return true
+	}
+	return false
+}
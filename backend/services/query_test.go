@@ -0,0 +1,134 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+var queryInstances = []models.AkriInstance{
+	{
+		UUID: "u1", Cluster: "plant-1", DeviceType: "esp32", Status: "active",
+		LastUpdated: "2025-07-01T10:00:00Z", CurrentVersion: "0.10.0",
+		BrokerProperties: map[string]string{"SITE": "plant-north", "FIRMWARE": "v2.1", "SLOTS": "10", "ROOM": "àlpha"},
+	},
+	{
+		UUID: "u2", Cluster: "plant-1", DeviceType: "esp32s3", Status: "flashing",
+		LastUpdated: "2025-07-02T23:59:59Z", CurrentVersion: "0.9.3",
+		BrokerProperties: map[string]string{"SITE": "plant-south", "FIRMWARE": "v1.9", "SLOTS": "9"},
+	},
+	{
+		UUID: "u3", Cluster: "plant-2", DeviceType: "rpi", Status: "busy",
+		LastUpdated: "2025-06-30T08:00:00Z", CurrentVersion: "1.0.0",
+		BrokerProperties: map[string]string{"SITE": "lab", "SLOTS": "abc"},
+	},
+}
+
+func TestParseQueryMatches(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"u1", "u2", "u3"}},
+		{"deviceType = ESP32", []string{"u1"}},
+		{"deviceType == esp32 OR deviceType = rpi", []string{"u1", "u3"}},
+		{"deviceType in (esp32, esp32s3) AND NOT status = flashing", []string{"u1"}},
+		{"deviceType not in (esp32, esp32s3)", []string{"u3"}},
+		{"site ^= PLANT-", []string{"u1", "u2"}},
+		{`FIRMWARE =~ "^v2\\."`, []string{"u1"}},
+		{`brokerProperties.FIRMWARE !~ "^v2"`, []string{"u2", "u3"}},
+		{"(site ^= plant- OR cluster = plant-2) AND status != active", []string{"u2", "u3"}},
+		{"a = b OR deviceType = rpi AND status = busy", []string{"u3"}},
+		{"NOT (deviceType = esp32 OR deviceType = rpi)", []string{"u2"}},
+		{"lastUpdated = 2025-07-02", []string{"u2"}},
+		{"lastUpdated > 2025-07-01", []string{"u2"}},
+		{"lastUpdated >= 2025-07-01", []string{"u1", "u2"}},
+		{"lastUpdated < 2025-07-01T00:00:00Z", []string{"u3"}},
+		{"lastUpdated ^= 2025-07", []string{"u1", "u2"}},
+		{"currentVersion > 0.9.10", []string{"u1", "u3"}},
+		// "abc" is not numeric, so it compares with 9.5 as a string.
+		{"SLOTS > 9.5", []string{"u1", "u3"}},
+		{"slots <= 9", []string{"u2"}},
+		{"ROOM = àlpha", []string{"u1"}},
+		{`SITE = "plant north"`, nil},
+		{"missing = x", nil},
+		{"missing != x", []string{"u1", "u2", "u3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("ParseQuery(%q): %v", tt.query, err)
+			}
+			var got []string
+			for _, instance := range queryInstances {
+				if query.Matches(instance) {
+					got = append(got, instance.UUID)
+				}
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseQuery(%q) matched %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, text := range []string{
+		"deviceType",
+		"deviceType =",
+		"deviceType ~ esp32",
+		"deviceType = esp32 AND",
+		"(deviceType = esp32",
+		"deviceType = esp32)",
+		"deviceType in esp32",
+		"deviceType in (esp32",
+		"deviceType not esp32",
+		"deviceType = and",
+		`"deviceType" = esp32`,
+		`FIRMWARE =~ "("`,
+		`deviceType = "unterminated`,
+	} {
+		if _, err := ParseQuery(text); !errors.Is(err, ErrInvalidQuery) {
+			t.Errorf("ParseQuery(%q) error = %v, want ErrInvalidQuery", text, err)
+		}
+	}
+}
+
+func TestLexQueryKeepsMultibyteValuesWhole(t *testing.T) {
+	tokens, err := lexQuery("ROOM = àlpha x AND name=Ωmega")
+	if err != nil {
+		t.Fatalf("lexQuery: %v", err)
+	}
+	var got []string
+	for _, token := range tokens {
+		got = append(got, token.text)
+	}
+	want := []string{"ROOM", "=", "àlpha", "x", "AND", "name", "=", "Ωmega"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("lexQuery tokens = %q, want %q", got, want)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	tests := []struct {
+		actual, expected string
+		want             int
+	}{
+		{"0.1.1", "0.10.0", -1},
+		{"v2.3", "2.3.0", 0},
+		{"10", "9", 1},
+		{"2025-07-01T10:00:00Z", "2025-07-01", 0},
+		{"2025-07-01T10:00:00Z", "2025-07-01T09:00:00Z", 1},
+		{"Beta", "alpha", 1},
+	}
+	for _, tt := range tests {
+		if got := compareValues(tt.actual, tt.expected); got != tt.want {
+			t.Errorf("compareValues(%q, %q) = %d, want %d", tt.actual, tt.expected, got, tt.want)
+		}
+	}
+}
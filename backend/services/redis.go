@@ -85,4 +85,65 @@ func (s *RedisService) SetExpiration(key string, duration time.Duration) {
 	if err != nil {
 		s.logger.Printf("Error setting expiration in Redis: %v", err)
 	}
-}
\ No newline at end of file
+}
+// HSetValue stores value as JSON under field of the hash at key.
+func (s *RedisService) HSetValue(key, field string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		s.logger.Printf("Error marshaling value for Redis hash: %v", err)
+		return err
+	}
+	if err := s.client.HSet(context.Background(), key, field, data).Err(); err != nil {
+		s.logger.Printf("Error setting hash field in Redis: %v", err)
+		return err
+	}
+	return nil
+}
+
+// HGetValue decodes field of the hash at key into dest. found is false when
+// the field does not exist.
+func (s *RedisService) HGetValue(key, field string, dest interface{}) (bool, error) {
+	data, err := s.client.HGet(context.Background(), key, field).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	}
+	if err != nil {
+		s.logger.Printf("Error getting hash field from Redis: %v", err)
+		return false, err
+	}
+	return true, json.Unmarshal(data, dest)
+}
+
+// HGetAllValues returns the raw JSON of every field of the hash at key.
+func (s *RedisService) HGetAllValues(key string) (map[string]string, error) {
+	values, err := s.client.HGetAll(context.Background(), key).Result()
+	if err != nil {
+		s.logger.Printf("Error getting hash from Redis: %v", err)
+		return nil, err
+	}
+	return values, nil
+}
+
+func (s *RedisService) HDelete(key, field string) error {
+	if err := s.client.HDel(context.Background(), key, field).Err(); err != nil {
+		s.logger.Printf("Error deleting hash field in Redis: %v", err)
+		return err
+	}
+	return nil
+}
+
+// LRangeValues returns the raw JSON of the list elements from start to stop.
+func (s *RedisService) LRangeValues(key string, start, stop int64) ([]string, error) {
+	items, err := s.client.LRange(context.Background(), key, start, stop).Result()
+	if err != nil {
+		s.logger.Printf("Error getting range from Redis list: %v", err)
+		return nil, err
+	}
+	return items, nil
+}
+
+func (s *RedisService) LTrimList(key string, start, stop int64) {
+	if err := s.client.LTrim(context.Background(), key, start, stop).Err(); err != nil {
+		s.logger.Printf("Error trimming Redis list: %v", err)
+	}
+}
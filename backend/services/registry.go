@@ -0,0 +1,482 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidReference    = errors.New("invalid image reference")
+	ErrImageNotFound       = errors.New("image not found in registry")
+	ErrRegistryUnavailable = errors.New("registry unavailable")
+)
+
+const (
+	dockerHubRegistry = "registry-1.docker.io"
+	// registryPageSize is the tag page size asked for; registries may cap it.
+	registryPageSize = 1000
+)
+
+// manifestMediaTypes are accepted when resolving a tag, so multi-arch
+// indexes resolve to the index digest rather than one platform's manifest.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+var digestPattern = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+
+// ImageReference is a parsed image reference such as
+// "registry:5000/team/firmware:v1.2@sha256:...".
+type ImageReference struct {
+	Registry   string `json:"registry"`
+	Repository string `json:"repository"`
+	Tag        string `json:"tag,omitempty"`
+	Digest     string `json:"digest,omitempty"`
+}
+
+// String renders the reference with its tag and digest, whichever are set.
+func (r ImageReference) String() string {
+	ref := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		ref += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		ref += "@" + r.Digest
+	}
+	return ref
+}
+
+// ParseImageReference splits ref into registry, repository, tag and digest.
+// References without a registry host are Docker Hub images, and a reference
+// with neither tag nor digest means "latest".
+func ParseImageReference(ref string) (ImageReference, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.ContainsAny(ref, " \t\n") {
+		return ImageReference{}, fmt.Errorf("%w: %q", ErrInvalidReference, ref)
+	}
+	var parsed ImageReference
+	if name, digest, ok := strings.Cut(ref, "@"); ok {
+		if !digestPattern.MatchString(digest) {
+			return ImageReference{}, fmt.Errorf("%w: %q has an invalid digest", ErrInvalidReference, ref)
+		}
+		ref, parsed.Digest = name, digest
+	}
+	if slash := strings.LastIndex(ref, "/"); strings.LastIndex(ref, ":") > slash {
+		colon := strings.LastIndex(ref, ":")
+		ref, parsed.Tag = ref[:colon], ref[colon+1:]
+	}
+
+	first, rest, hasSlash := strings.Cut(ref, "/")
+	if hasSlash && (strings.ContainsAny(first, ".:") || first == "localhost") {
+		parsed.Registry, parsed.Repository = first, rest
+	} else {
+		parsed.Registry, parsed.Repository = dockerHubRegistry, ref
+		if !hasSlash {
+			parsed.Repository = "library/" + ref
+		}
+	}
+	if parsed.Registry == "docker.io" || parsed.Registry == "index.docker.io" {
+		parsed.Registry = dockerHubRegistry
+	}
+	if parsed.Repository == "" || parsed.Repository != strings.ToLower(parsed.Repository) {
+		return ImageReference{}, fmt.Errorf("%w: %q must have a lowercase repository", ErrInvalidReference, ref)
+	}
+	if parsed.Tag == "" && parsed.Digest == "" {
+		parsed.Tag = "latest"
+	}
+	return parsed, nil
+}
+
+// SameImage reports whether a and b name the same repository and tag,
+// ignoring digests and how Docker Hub references are spelled.
+func SameImage(a, b string) bool {
+	refA, errA := ParseImageReference(a)
+	refB, errB := ParseImageReference(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return refA.Registry == refB.Registry && refA.Repository == refB.Repository && refA.Tag == refB.Tag
+}
+
+// withoutDigest drops the "@sha256:..." a pinned reference ends with.
+func withoutDigest(ref string) string {
+	name, _, _ := strings.Cut(ref, "@")
+	return name
+}
+
+type registryCredential struct {
+	Username string
+	Password string
+}
+
+// RegistryClient talks to image registries over the OCI distribution API.
+type RegistryClient struct {
+	verify        bool
+	httpClient    *http.Client
+	credentials   map[string]registryCredential
+	insecureHosts map[string]bool
+	allowedHosts  map[string]bool
+	logger        *log.Logger
+}
+
+// NewRegistryClient reads registry credentials from authFile, a
+// .dockerconfigjson as stored in a kubernetes.io/dockerconfigjson Secret.
+// Hosts in insecureHosts are reached over plain HTTP. verify makes rollouts
+// resolve and pin their images before any FlashJob is created. Image
+// references are user input, so only the registries of authFile,
+// insecureHosts and allowedHosts are contacted; any other is refused as an
+// invalid reference.
+func NewRegistryClient(verify bool, authFile string, insecureHosts, allowedHosts []string, logger *log.Logger) (*RegistryClient, error) {
+	client := &RegistryClient{
+		verify:        verify,
+		httpClient:    &http.Client{Timeout: 15 * time.Second},
+		credentials:   map[string]registryCredential{},
+		insecureHosts: map[string]bool{},
+		allowedHosts:  map[string]bool{},
+		logger:        logger,
+	}
+	for _, host := range insecureHosts {
+		client.insecureHosts[host] = true
+		client.allowedHosts[registryHost(host)] = true
+	}
+	for _, host := range allowedHosts {
+		client.allowedHosts[registryHost(host)] = true
+	}
+	if authFile == "" {
+		return client, nil
+	}
+
+	data, err := os.ReadFile(authFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading registry auth file: %w", err)
+	}
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parsing registry auth file: %w", err)
+	}
+	for host, auth := range config.Auths {
+		credential := registryCredential{Username: auth.Username, Password: auth.Password}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("decoding registry auth for %s: %w", host, err)
+			}
+			credential.Username, credential.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		host = registryHost(host)
+		client.credentials[host] = credential
+		client.allowedHosts[host] = true
+	}
+	logger.Printf("Loaded registry credentials for %d registries", len(client.credentials))
+	return client, nil
+}
+
+// registryHost reduces a registry as written in an auth file or setting,
+// possibly as a URL, to the host ParseImageReference reports.
+func registryHost(host string) string {
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host = strings.Split(host, "/")[0]
+	if host == "docker.io" || host == "index.docker.io" {
+		host = dockerHubRegistry
+	}
+	return host
+}
+
+// Verifies reports whether rollouts must resolve their images first.
+func (c *RegistryClient) Verifies() bool {
+	return c.verify
+}
+
+// Resolve checks that ref exists and returns it pinned to its manifest
+// digest. A reference that already carries a digest must match it.
+func (c *RegistryClient) Resolve(ref string) (ImageReference, error) {
+	parsed, err := ParseImageReference(ref)
+	if err != nil {
+		return ImageReference{}, err
+	}
+	target := parsed.Digest
+	if target == "" {
+		target = parsed.Tag
+	}
+
+	resp, err := c.do(parsed, http.MethodHead, "/manifests/"+target)
+	if err != nil {
+		return ImageReference{}, err
+	}
+	resp.Body.Close()
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		// Some registries only send the digest on GET; hash the manifest.
+		resp, err = c.do(parsed, http.MethodGet, "/manifests/"+target)
+		if err != nil {
+			return ImageReference{}, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return ImageReference{}, fmt.Errorf("%w: %s: %v", ErrRegistryUnavailable, parsed.Registry, err)
+		}
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if parsed.Digest != "" && parsed.Digest != digest {
+		return ImageReference{}, fmt.Errorf("%w: %s resolves to %s", ErrImageNotFound, ref, digest)
+	}
+	parsed.Digest = digest
+	return parsed, nil
+}
+
+// Manifest fetches the manifest ref points to.
+func (c *RegistryClient) Manifest(ref ImageReference) ([]byte, error) {
+	target := ref.Digest
+	if target == "" {
+		target = ref.Tag
+	}
+	return c.fetch(ref, "/manifests/"+target)
+}
+
+// Blob fetches a blob of ref's repository and checks it against digest.
+func (c *RegistryClient) Blob(ref ImageReference, digest string) ([]byte, error) {
+	if !digestPattern.MatchString(digest) {
+		return nil, fmt.Errorf("%w: unsupported blob digest %q", ErrInvalidReference, digest)
+	}
+	data, err := c.fetch(ref, "/blobs/"+digest)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("%w: blob %s does not match its digest", ErrRegistryUnavailable, digest)
+	}
+	return data, nil
+}
+
+func (c *RegistryClient) fetch(ref ImageReference, path string) ([]byte, error) {
+	resp, err := c.do(ref, http.MethodGet, path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrRegistryUnavailable, ref.Registry, err)
+	}
+	return data, nil
+}
+
+// Tags lists the tags of ref's repository, following pagination links.
+func (c *RegistryClient) Tags(ref string) ([]string, error) {
+	parsed, err := ParseImageReference(ref)
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	path := fmt.Sprintf("/tags/list?n=%d", registryPageSize)
+	for path != "" {
+		resp, err := c.do(parsed, http.MethodGet, path)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrRegistryUnavailable, parsed.Registry, err)
+		}
+		tags = append(tags, page.Tags...)
+		path = nextPagePath(resp.Header.Get("Link"), parsed.Repository)
+	}
+	return tags, nil
+}
+
+// nextPagePath extracts the path below the repository from a
+// `<...>; rel="next"` Link header.
+func nextPagePath(link, repository string) string {
+	if link == "" || !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end <= start {
+		return ""
+	}
+	next, err := url.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	prefix := "/v2/" + repository
+	if !strings.HasPrefix(next.Path, prefix) {
+		return ""
+	}
+	path := strings.TrimPrefix(next.Path, prefix)
+	if next.RawQuery != "" {
+		path += "?" + next.RawQuery
+	}
+	return path
+}
+
+// do sends a request for path below the repository, answering a 401
+// challenge with basic auth or a bearer token as the registry asks. Non-2xx
+// responses are returned as errors.
+func (c *RegistryClient) do(ref ImageReference, method, path string) (*http.Response, error) {
+	if !c.allowedHosts[ref.Registry] {
+		return nil, fmt.Errorf("%w: registry %s is not allowed", ErrInvalidReference, ref.Registry)
+	}
+	scheme := "https"
+	if c.insecureHosts[ref.Registry] {
+		scheme = "http"
+	}
+	endpoint := fmt.Sprintf("%s://%s/v2/%s%s", scheme, ref.Registry, ref.Repository, path)
+
+	resp, err := c.send(method, endpoint, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := c.authorize(ref, challenge)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = c.send(method, endpoint, authorization); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return resp, nil
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrImageNotFound, ref)
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: access to %s denied (%s), check the registry credentials", ErrRegistryUnavailable, ref.Registry, resp.Status)
+	}
+	resp.Body.Close()
+	return nil, fmt.Errorf("%w: %s answered %s", ErrRegistryUnavailable, ref.Registry, resp.Status)
+}
+
+func (c *RegistryClient) send(method, endpoint, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestMediaTypes, ", "))
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrRegistryUnavailable, err)
+	}
+	return resp, nil
+}
+
+// authorize answers a WWW-Authenticate challenge with an Authorization
+// header value.
+func (c *RegistryClient) authorize(ref ImageReference, challenge string) (string, error) {
+	credential, hasCredential := c.credentials[ref.Registry]
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if !hasCredential {
+			return "", fmt.Errorf("%w: %s requires credentials", ErrRegistryUnavailable, ref.Registry)
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credential.Username+":"+credential.Password)), nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("%w: %s sent an unsupported auth challenge %q", ErrRegistryUnavailable, ref.Registry, challenge)
+	}
+
+	tokenURL, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", fmt.Errorf("%w: %s sent an invalid auth realm", ErrRegistryUnavailable, ref.Registry)
+	}
+	query := tokenURL.Query()
+	if params["service"] != "" {
+		query.Set("service", params["service"])
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	tokenURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCredential {
+		req.SetBasicAuth(credential.Username, credential.Password)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: token request: %v", ErrRegistryUnavailable, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: token request to %s answered %s", ErrRegistryUnavailable, tokenURL.Host, resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", fmt.Errorf("%w: token response: %v", ErrRegistryUnavailable, err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// parseChallenge splits `Bearer realm="...",service="..."` into its scheme
+// and parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var pair string
+		rest = strings.TrimLeft(rest, " ,")
+		key, value, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		if strings.HasPrefix(value, `"`) {
+			end := strings.Index(value[1:], `"`)
+			if end < 0 {
+				break
+			}
+			pair, rest = value[1:end+1], value[end+2:]
+		} else {
+			pair, rest, _ = strings.Cut(value, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = pair
+	}
+	return scheme, params
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var nodeGVR = schema.GroupVersionResource{Version: "v1", Resource: "nodes"}
+
+var (
+	ErrUnknownUUIDs       = errors.New("UUIDs do not match any Akri instance")
+	ErrConflictingTargets = errors.New("target devices need different values")
+)
+
+// Broker property keys each FlashJob spec field is read from, first match
+// wins.
+var (
+	externalIPProperties   = []string{"EXTERNAL_IP", "IP_ADDRESS", "IP"}
+	hostEndpointProperties = []string{"HOST_ENDPOINT", "ENDPOINT"}
+)
+
+// ResolveFlashJobSpec fills the device, applicationType, externalIP and
+// hostEndpoint fields the request left unset from the target instances. A
+// field is only filled when every target agrees on its value. Differing
+// device or applicationType values are returned as warnings and the field
+// stays null, but a FlashJob cannot reach devices at different endpoints, so
+// differing externalIP or hostEndpoint values fail with
+// ErrConflictingTargets naming the devices behind each value. When no broker
+// property carries an IP, the address of the node the device hangs off is
+// used.
+func (s *KubernetesService) ResolveFlashJobSpec(spec *models.FlashJobSpec) ([]string, error) {
+	if s.client == nil {
+		return nil, errors.New("Kubernetes client not initialized")
+	}
+	if !s.hasSynced() {
+		return nil, ErrCacheNotSynced
+	}
+
+	byUUID := map[string]*unstructured.Unstructured{}
+	objects, err := s.listCachedInstances(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objects {
+		if item, ok := obj.(*unstructured.Unstructured); ok {
+			byUUID[string(item.GetUID())] = item
+		}
+	}
+	var unknown []string
+	targets := make([]*unstructured.Unstructured, 0, len(spec.UUIDs))
+	for _, uuid := range spec.UUIDs {
+		item, ok := byUUID[uuid]
+		if !ok {
+			unknown = append(unknown, uuid)
+			continue
+		}
+		targets = append(targets, item)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownUUIDs, strings.Join(unknown, ", "))
+	}
+
+	nodeIPs := map[string]string{}
+	values := map[string][]string{}
+	for _, item := range targets {
+		props := brokerProperties(item)
+		values["device"] = append(values["device"], props["DEVICE"])
+		values["applicationType"] = append(values["applicationType"], props["APPLICATION_TYPE"])
+		values["hostEndpoint"] = append(values["hostEndpoint"], firstProperty(props, hostEndpointProperties))
+		ip := firstProperty(props, externalIPProperties)
+		if ip == "" && spec.ExternalIP == nil {
+			ip = s.instanceNodeIP(item, nodeIPs)
+		}
+		values["externalIP"] = append(values["externalIP"], ip)
+	}
+
+	var warnings []string
+	fields := map[string]**string{
+		"device":          &spec.Device,
+		"applicationType": &spec.ApplicationType,
+		"externalIP":      &spec.ExternalIP,
+		"hostEndpoint":    &spec.HostEndpoint,
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		field := fields[name]
+		if *field != nil {
+			continue
+		}
+		value, ok := commonValue(values[name])
+		if !ok && (name == "externalIP" || name == "hostEndpoint") {
+			return nil, fmt.Errorf("%w: %s differs between %s, flash them in separate FlashJobs or set %s",
+				ErrConflictingTargets, name, devicesByValue(spec.UUIDs, values[name]), name)
+		}
+		if !ok {
+			warnings = append(warnings, fmt.Sprintf("%s differs between the selected devices and was left unset", name))
+			continue
+		}
+		if value != "" {
+			*field = &value
+		}
+	}
+	return warnings, nil
+}
+
+// instanceNodeIP returns the ExternalIP, or failing that the InternalIP, of
+// the first node that reports the instance. Lookups are memoised in nodeIPs.
+func (s *KubernetesService) instanceNodeIP(item *unstructured.Unstructured, nodeIPs map[string]string) string {
+	nodes, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "nodes")
+	if len(nodes) == 0 {
+		return ""
+	}
+	name := nodes[0]
+	if ip, ok := nodeIPs[name]; ok {
+		return ip
+	}
+
+	node, err := s.client.Resource(nodeGVR).Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		s.logger.Printf("Failed to get node %s: %v", name, err)
+		nodeIPs[name] = ""
+		return ""
+	}
+	addresses, _, _ := unstructured.NestedSlice(node.Object, "status", "addresses")
+	found := map[string]string{}
+	for _, address := range addresses {
+		if a, ok := address.(map[string]interface{}); ok {
+			addressType, _ := a["type"].(string)
+			value, _ := a["address"].(string)
+			found[addressType] = value
+		}
+	}
+	ip := found["ExternalIP"]
+	if ip == "" {
+		ip = found["InternalIP"]
+	}
+	nodeIPs[name] = ip
+	return ip
+}
+
+func firstProperty(props map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := props[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// devicesByValue lists which of uuids has each non-empty value, values
+// being in the order of uuids, as "value (uuid, uuid); value (uuid)".
+func devicesByValue(uuids, values []string) string {
+	var order []string
+	devices := map[string][]string{}
+	for i, value := range values {
+		if value == "" {
+			continue
+		}
+		if _, ok := devices[value]; !ok {
+			order = append(order, value)
+		}
+		devices[value] = append(devices[value], uuids[i])
+	}
+	parts := make([]string, 0, len(order))
+	for _, value := range order {
+		parts = append(parts, fmt.Sprintf("%s (%s)", value, strings.Join(devices[value], ", ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// commonValue returns the single non-empty value shared by values, "" when
+// all are empty, and false when they disagree.
+func commonValue(values []string) (string, bool) {
+	common := ""
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if common != "" && common != value {
+			return "", false
+		}
+		common = value
+	}
+	return common, true
+}
@@ -0,0 +1,549 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+)
+
+var (
+	ErrRolloutNotFound = errors.New("rollout not found")
+	ErrInvalidRollout  = errors.New("invalid rollout")
+	ErrRolloutFinished = errors.New("rollout is no longer running")
+)
+
+// rolloutsKey is the Redis hash holding every rollout as JSON, keyed by ID.
+const rolloutsKey = "rollouts"
+
+const rolloutPollInterval = 15 * time.Second
+
+// DefaultWaves flashes one canary device, then 10% of the fleet, then the
+// rest.
+var DefaultWaves = []string{"1", "10%", "rest"}
+
+const DefaultSuccessThreshold = 1.0
+
+var successfulPhases = map[string]bool{
+	"succeeded": true,
+	"completed": true,
+}
+
+// RolloutService drives staged rollouts. Each running rollout is polled by its
+// own goroutine; state is persisted to Redis on every change so rollouts
+// resume after a restart.
+type RolloutService struct {
+	mu       sync.Mutex
+	rollouts map[string]*models.Rollout
+	clusters *ClusterRegistry
+	groups   *DeviceGroups
+	redis    *RedisService
+	logger   *log.Logger
+	stopCh   <-chan struct{}
+}
+
+func NewRolloutService(clusters *ClusterRegistry, groups *DeviceGroups, redis *RedisService, logger *log.Logger) *RolloutService {
+	return &RolloutService{
+		rollouts: make(map[string]*models.Rollout),
+		clusters: clusters,
+		groups:   groups,
+		redis:    redis,
+		logger:   logger,
+	}
+}
+
+// Start loads the persisted rollouts and resumes the ones still running.
+func (s *RolloutService) Start(stopCh <-chan struct{}) {
+	s.stopCh = stopCh
+	values, err := s.redis.HGetAllValues(rolloutsKey)
+	if err != nil {
+		s.logger.Printf("Failed to load rollouts: %v", err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, value := range values {
+		var rollout models.Rollout
+		if err := json.Unmarshal([]byte(value), &rollout); err != nil {
+			s.logger.Printf("Skipping unreadable rollout %s: %v", id, err)
+			continue
+		}
+		s.rollouts[id] = &rollout
+		if active(&rollout) {
+			s.logger.Printf("Resuming rollout %s at wave %d", id, rollout.CurrentWave+1)
+			go s.run(id)
+		}
+	}
+}
+
+// SplitWaves divides uuids into waves. Each stage is a device count ("1"), a
+// percentage of all devices ("10%") or "rest"; the last wave always takes
+// whatever is left, and stages past the last device are dropped.
+func SplitWaves(uuids []string, stages []string) ([][]string, error) {
+	if len(stages) == 0 {
+		stages = DefaultWaves
+	}
+	total := len(uuids)
+	sizes := make([]int, len(stages))
+	for i, stage := range stages {
+		stage = strings.TrimSpace(stage)
+		switch {
+		case stage == "rest":
+			sizes[i] = total
+		case strings.HasSuffix(stage, "%"):
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(stage, "%"), 64)
+			if err != nil || percent <= 0 || percent > 100 {
+				return nil, fmt.Errorf("%w: wave %q is not a percentage between 0 and 100", ErrInvalidRollout, stage)
+			}
+			sizes[i] = int(math.Ceil(percent / 100 * float64(total)))
+		default:
+			count, err := strconv.Atoi(stage)
+			if err != nil || count <= 0 {
+				return nil, fmt.Errorf("%w: wave %q must be a positive count, a percentage or \"rest\"", ErrInvalidRollout, stage)
+			}
+			sizes[i] = count
+		}
+	}
+
+	var waves [][]string
+	start := 0
+	for i, size := range sizes {
+		if start >= total {
+			break
+		}
+		if remaining := total - start; size > remaining || i == len(sizes)-1 {
+			size = remaining
+		}
+		waves = append(waves, uuids[start:start+size])
+		start += size
+	}
+	return waves, nil
+}
+
+// RolloutOptions control how a rollout is staged and when it may run.
+type RolloutOptions struct {
+	Waves            []string
+	SuccessThreshold float64
+	// StartAt, in RFC 3339, holds back the first wave until then.
+	StartAt string
+	// Window, when set, is the only time waves may start.
+	Window *models.MaintenanceWindow
+	// Target, when set, picks the devices again as the first wave starts.
+	Target *models.RolloutTarget
+}
+
+// ValidateRolloutOptions checks opts against the devices of a rollout and
+// returns the waves they split into.
+func ValidateRolloutOptions(uuids []string, opts RolloutOptions) ([][]string, error) {
+	if opts.SuccessThreshold <= 0 || opts.SuccessThreshold > 1 {
+		return nil, fmt.Errorf("%w: successThreshold must be in (0, 1]", ErrInvalidRollout)
+	}
+	waves, err := SplitWaves(uuids, opts.Waves)
+	if err != nil {
+		return nil, err
+	}
+	if opts.StartAt != "" {
+		if _, err := time.Parse(time.RFC3339, opts.StartAt); err != nil {
+			return nil, fmt.Errorf("%w: startAt must be an RFC 3339 time", ErrInvalidRollout)
+		}
+	}
+	if opts.Window != nil {
+		if err := validateWindow(opts.Window); err != nil {
+			return nil, err
+		}
+	}
+	return waves, nil
+}
+
+// Create starts a rollout of spec on cluster. spec must already be resolved;
+// every wave's FlashJob is spec with UUIDs narrowed to that wave.
+func (s *RolloutService) Create(cluster *KubernetesService, namespace string, spec models.FlashJobSpec, opts RolloutOptions) (models.Rollout, error) {
+	waves, err := ValidateRolloutOptions(spec.UUIDs, opts)
+	if err != nil {
+		return models.Rollout{}, err
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	rollout := &models.Rollout{
+		ID:               "rollout-" + utilrand.String(8),
+		Cluster:          cluster.Name(),
+		Namespace:        namespace,
+		Spec:             spec,
+		SuccessThreshold: opts.SuccessThreshold,
+		StartAt:          opts.StartAt,
+		Window:           opts.Window,
+		Target:           opts.Target,
+		Stages:           opts.Waves,
+		Phase:            models.RolloutRunning,
+		CreatedAt:        now,
+	}
+	if opts.StartAt != "" || opts.Window != nil {
+		rollout.Phase = models.RolloutScheduled
+	}
+	for _, uuids := range waves {
+		rollout.Waves = append(rollout.Waves, models.RolloutWave{UUIDs: uuids, Phase: "Pending"})
+	}
+
+	s.mu.Lock()
+	s.rollouts[rollout.ID] = rollout
+	s.save(rollout)
+	result := copyRollout(rollout)
+	s.mu.Unlock()
+
+	s.logger.Printf("Created rollout %s on cluster %s with %d waves", rollout.ID, rollout.Cluster, len(rollout.Waves))
+	go s.run(rollout.ID)
+	return result, nil
+}
+
+// List returns every rollout, newest first.
+func (s *RolloutService) List() []models.Rollout {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rollouts := make([]models.Rollout, 0, len(s.rollouts))
+	for _, rollout := range s.rollouts {
+		rollouts = append(rollouts, copyRollout(rollout))
+	}
+	sort.Slice(rollouts, func(i, j int) bool {
+		return rollouts[i].CreatedAt > rollouts[j].CreatedAt
+	})
+	return rollouts
+}
+
+func (s *RolloutService) Get(id string) (models.Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rollout, ok := s.rollouts[id]
+	if !ok {
+		return models.Rollout{}, fmt.Errorf("%w: %s", ErrRolloutNotFound, id)
+	}
+	return copyRollout(rollout), nil
+}
+
+// Cancel stops a scheduled or running rollout before its next wave. The
+// FlashJob of the current wave, if any, is left to finish.
+func (s *RolloutService) Cancel(id string) (models.Rollout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rollout, ok := s.rollouts[id]
+	if !ok {
+		return models.Rollout{}, fmt.Errorf("%w: %s", ErrRolloutNotFound, id)
+	}
+	if !active(rollout) {
+		return models.Rollout{}, fmt.Errorf("%w: %s is %s", ErrRolloutFinished, id, rollout.Phase)
+	}
+	rollout.Phase = models.RolloutCancelled
+	rollout.Message = fmt.Sprintf("cancelled during wave %d", rollout.CurrentWave+1)
+	s.save(rollout)
+	s.audit(rollout)
+	return copyRollout(rollout), nil
+}
+
+func (s *RolloutService) run(id string) {
+	ticker := time.NewTicker(rolloutPollInterval)
+	defer ticker.Stop()
+	for s.step(id) {
+		select {
+		case <-ticker.C:
+		case <-s.stopCh:
+			return
+		}
+	}
+}
+
+// step advances the rollout by at most one state change and reports whether
+// it is still running. Calls to the cluster are made without holding s.mu so
+// that List and Get are not held up by the API server; only this goroutine
+// changes the rollout's waves, so after relocking just its phase may have
+// changed, by Cancel.
+func (s *RolloutService) step(id string) bool {
+	s.mu.Lock()
+	rollout, ok := s.rollouts[id]
+	if !ok || !active(rollout) {
+		s.mu.Unlock()
+		return false
+	}
+	cluster, err := s.clusters.Get(rollout.Cluster)
+	if err != nil {
+		s.halt(rollout, err.Error())
+		s.mu.Unlock()
+		return false
+	}
+	if rollout.Waves[rollout.CurrentWave].FlashJob == "" {
+		if !s.mayStartWave(rollout) {
+			s.mu.Unlock()
+			return true
+		}
+		next := copyRollout(rollout)
+		s.mu.Unlock()
+		return s.startWave(rollout, &next, cluster)
+	}
+	current, flashJob := rollout.CurrentWave, rollout.Waves[rollout.CurrentWave].FlashJob
+	s.mu.Unlock()
+
+	job, err := cluster.GetFlashJob(rollout.Namespace, flashJob)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !active(rollout) {
+		return false
+	}
+	wave := &rollout.Waves[current]
+	now := time.Now().UTC().Format(time.RFC3339)
+	if apierrors.IsNotFound(err) {
+		wave.Phase = "Failed"
+		wave.FinishedAt = now
+		s.halt(rollout, fmt.Sprintf("wave %d: FlashJob %s was deleted", current+1, flashJob))
+		return false
+	}
+	if err != nil {
+		// Transient API errors are retried on the next tick.
+		s.logger.Printf("Rollout %s: failed to get FlashJob %s: %v", id, flashJob, err)
+		return true
+	}
+
+	succeeded, failed, done := tallyWave(wave.UUIDs, job)
+	if succeeded != wave.Succeeded || failed != wave.Failed {
+		wave.Succeeded, wave.Failed = succeeded, failed
+		s.save(rollout)
+	}
+	if !done {
+		return true
+	}
+
+	wave.FinishedAt = now
+	if !meetsThreshold(succeeded, len(wave.UUIDs), rollout.SuccessThreshold) {
+		wave.Phase = "Failed"
+		s.halt(rollout, fmt.Sprintf("wave %d: %d of %d devices succeeded, below the %.0f%% threshold",
+			current+1, succeeded, len(wave.UUIDs), rollout.SuccessThreshold*100))
+		return false
+	}
+	wave.Phase = "Succeeded"
+	if current == len(rollout.Waves)-1 {
+		rollout.Phase = models.RolloutSucceeded
+		rollout.Message = fmt.Sprintf("all %d waves succeeded", len(rollout.Waves))
+		s.save(rollout)
+		s.audit(rollout)
+		return false
+	}
+	rollout.CurrentWave++
+	s.save(rollout)
+	return true
+}
+
+// tallyWave counts the wave's devices the FlashJob flashed and failed, and
+// reports whether all of them are done. Every device of the wave counts; one
+// the operator has not reported on yet is still running, until its FlashJob
+// has gone unreported for too long and it counts as failed.
+func tallyWave(uuids []string, job models.FlashJob) (succeeded, failed int, done bool) {
+	phases := make(map[string]string, len(job.Status.Devices))
+	for _, device := range job.Status.Devices {
+		phases[device.UUID] = device.Phase
+	}
+	done = true
+	for _, uuid := range uuids {
+		phase, ok := phases[uuid]
+		switch {
+		case !ok || inFlight(job, phase):
+			done = false
+		case successfulPhases[strings.ToLower(phase)]:
+			succeeded++
+		default:
+			failed++
+		}
+	}
+	return succeeded, failed, done
+}
+
+// meetsThreshold reports whether succeeded of total devices is at least the
+// threshold share.
+func meetsThreshold(succeeded, total int, threshold float64) bool {
+	return float64(succeeded) >= threshold*float64(total)
+}
+
+// startWave creates the FlashJob of next's current wave, resolving the
+// rollout's target first when it is the first wave, and then records the
+// outcome on rollout. It is called without s.mu held.
+func (s *RolloutService) startWave(rollout, next *models.Rollout, cluster *KubernetesService) bool {
+	var err error
+	if next.CurrentWave == 0 && next.Target != nil {
+		err = s.retarget(next, cluster)
+	}
+	wave := &next.Waves[next.CurrentWave]
+	spec := next.Spec
+	spec.UUIDs = wave.UUIDs
+	name := NewFlashJobName(wave.UUIDs)
+	if err == nil {
+		if err = cluster.CreateFlashJob(next.Namespace, name, spec); err != nil {
+			err = fmt.Errorf("wave %d: failed to create FlashJob: %w", next.CurrentWave+1, err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err != nil {
+		if active(rollout) {
+			s.halt(rollout, err.Error())
+		}
+		return false
+	}
+	wave.FlashJob = name
+	wave.Phase = "Running"
+	wave.StartedAt = time.Now().UTC().Format(time.RFC3339)
+	rollout.Spec = next.Spec
+	rollout.Waves = next.Waves
+	if !active(rollout) {
+		// Cancelled while the FlashJob was being created: keep track of
+		// it, but leave the rollout cancelled.
+		s.save(rollout)
+		return false
+	}
+	rollout.Phase = models.RolloutRunning
+	rollout.Message = ""
+	rollout.NextWindowAt = ""
+	s.save(rollout)
+	s.audit(rollout)
+	return true
+}
+
+// retarget picks the rollout's devices from its group or selector as it
+// starts, dropping members whose DEVICE or APPLICATION_TYPE the firmware
+// does not support, and splits them into waves again.
+func (s *RolloutService) retarget(rollout *models.Rollout, cluster *KubernetesService) error {
+	target := rollout.Target
+	members, err := s.groups.Members(cluster, *target)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	uuids := CompatibleMembers(*target, members)
+	if len(uuids) == 0 {
+		return fmt.Errorf("target matches no compatible devices (%d members)", len(members))
+	}
+
+	spec := rollout.Spec
+	spec.UUIDs = uuids
+	spec.Device, spec.ApplicationType = target.Device, target.ApplicationType
+	spec.ExternalIP, spec.HostEndpoint = target.ExternalIP, target.HostEndpoint
+	warnings, err := cluster.ResolveFlashJobSpec(&spec)
+	if err != nil {
+		return fmt.Errorf("resolving target: %w", err)
+	}
+	waves, err := SplitWaves(uuids, rollout.Stages)
+	if err != nil {
+		return err
+	}
+	rollout.Spec = spec
+	rollout.Waves = rollout.Waves[:0]
+	for _, wave := range waves {
+		rollout.Waves = append(rollout.Waves, models.RolloutWave{UUIDs: wave, Phase: "Pending"})
+	}
+	s.logger.Printf("Rollout %s: target resolved to %d devices, %d incompatible skipped", rollout.ID, len(uuids), len(members)-len(uuids))
+	for _, warning := range warnings {
+		s.logger.Printf("Rollout %s: %s", rollout.ID, warning)
+	}
+	return nil
+}
+
+// CompatibleMembers returns the UUIDs of the members whose DEVICE and
+// APPLICATION_TYPE the target's firmware supports. Group and selector
+// rollouts skip the other members, whether they start now or later.
+func CompatibleMembers(target models.RolloutTarget, members []models.AkriInstanceDetail) []string {
+	var uuids []string
+	for _, member := range members {
+		if supportsDevice(target.DeviceTypes, member.DeviceType) && allows(target.ApplicationTypes, member.ApplicationType) {
+			uuids = append(uuids, member.UUID)
+		}
+	}
+	return uuids
+}
+
+// mayStartWave reports whether the rollout's start time has passed and its
+// maintenance window is open. While waiting it records when the wave can
+// start next.
+func (s *RolloutService) mayStartWave(rollout *models.Rollout) bool {
+	now := time.Now()
+	if rollout.StartAt != "" {
+		startAt, err := time.Parse(time.RFC3339, rollout.StartAt)
+		if err != nil {
+			s.halt(rollout, "invalid startAt: "+err.Error())
+			return false
+		}
+		if now.Before(startAt) {
+			s.wait(rollout, fmt.Sprintf("waiting for start time %s", rollout.StartAt), "")
+			return false
+		}
+	}
+	open, next, err := windowOpen(rollout.Window, now)
+	if err != nil {
+		s.halt(rollout, err.Error())
+		return false
+	}
+	if !open {
+		nextWindowAt := next.UTC().Format(time.RFC3339)
+		s.wait(rollout, fmt.Sprintf("wave %d waiting for the maintenance window opening at %s", rollout.CurrentWave+1, next.Format(time.RFC3339)), nextWindowAt)
+		return false
+	}
+	return true
+}
+
+// wait records why the next wave is held back, saving only on change.
+func (s *RolloutService) wait(rollout *models.Rollout, message, nextWindowAt string) {
+	if rollout.Message == message && rollout.NextWindowAt == nextWindowAt {
+		return
+	}
+	rollout.Message = message
+	rollout.NextWindowAt = nextWindowAt
+	s.save(rollout)
+}
+
+func (s *RolloutService) halt(rollout *models.Rollout, message string) {
+	rollout.Phase = models.RolloutHalted
+	rollout.Message = message
+	s.save(rollout)
+	s.audit(rollout)
+}
+
+// save persists the rollout; callers hold s.mu.
+func (s *RolloutService) save(rollout *models.Rollout) {
+	rollout.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	s.redis.HSetValue(rolloutsKey, rollout.ID, rollout)
+}
+
+// audit records the rollout's current state in the shared log list.
+func (s *RolloutService) audit(rollout *models.Rollout) {
+	message := fmt.Sprintf("Rollout %s %s", rollout.ID, strings.ToLower(rollout.Phase))
+	if rollout.Phase == models.RolloutRunning {
+		wave := rollout.Waves[rollout.CurrentWave]
+		message = fmt.Sprintf("Rollout %s started wave %d/%d with FlashJob %s for UUIDs: %s",
+			rollout.ID, rollout.CurrentWave+1, len(rollout.Waves), wave.FlashJob, strings.Join(wave.UUIDs, ", "))
+	} else if rollout.Message != "" {
+		message += ": " + rollout.Message
+	}
+	s.logger.Println(message)
+	s.redis.LPushList("logs", models.LogEntry{
+		Timestamp: time.Now().Unix(),
+		Message:   message,
+		Type:      "rollout",
+	})
+	s.redis.SetExpiration("logs", 48*time.Hour)
+}
+
+// active reports whether the rollout still has waves to run.
+func active(rollout *models.Rollout) bool {
+	return rollout.Phase == models.RolloutScheduled || rollout.Phase == models.RolloutRunning
+}
+
+func copyRollout(rollout *models.Rollout) models.Rollout {
+	result := *rollout
+	result.Waves = append([]models.RolloutWave(nil), rollout.Waves...)
+	return result
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+func TestSplitWaves(t *testing.T) {
+	uuids := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l"}
+	tests := []struct {
+		name   string
+		uuids  []string
+		stages []string
+		want   [][]string
+	}{
+		{"default stages", uuids, nil, [][]string{{"a"}, {"b", "c"}, {"d", "e", "f", "g", "h", "i", "j", "k", "l"}}},
+		{"counts", uuids[:5], []string{"2", "2"}, [][]string{{"a", "b"}, {"c", "d", "e"}}},
+		{"percentage rounds up", uuids[:5], []string{"50%", "rest"}, [][]string{{"a", "b", "c"}, {"d", "e"}}},
+		{"rest takes everything", uuids[:3], []string{"rest"}, [][]string{{"a", "b", "c"}}},
+		{"stages past the last device are dropped", uuids[:2], []string{"1", "1", "1", "rest"}, [][]string{{"a"}, {"b"}}},
+		{"oversized stage is capped", uuids[:3], []string{"10", "rest"}, [][]string{{"a", "b", "c"}}},
+		{"no devices", nil, []string{"1", "rest"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := SplitWaves(tt.uuids, tt.stages)
+			if err != nil {
+				t.Fatalf("SplitWaves: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitWaves(%v, %v) = %v, want %v", tt.uuids, tt.stages, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitWavesRejectsInvalidStages(t *testing.T) {
+	for _, stage := range []string{"0", "-1", "0%", "101%", "x%", "half", ""} {
+		if _, err := SplitWaves([]string{"a"}, []string{stage}); !errors.Is(err, ErrInvalidRollout) {
+			t.Errorf("SplitWaves(stage %q) error = %v, want ErrInvalidRollout", stage, err)
+		}
+	}
+}
+
+func TestValidateRolloutOptions(t *testing.T) {
+	window := &models.MaintenanceWindow{Cron: "0 2 * * *", Duration: "4h", Timezone: "Europe/Athens"}
+	tests := []struct {
+		name    string
+		opts    RolloutOptions
+		wantErr bool
+	}{
+		{"defaults", RolloutOptions{SuccessThreshold: 1}, false},
+		{"scheduled in a window", RolloutOptions{SuccessThreshold: 0.5, StartAt: "2026-01-02T03:04:05Z", Window: window}, false},
+		{"zero threshold", RolloutOptions{SuccessThreshold: 0}, true},
+		{"threshold above one", RolloutOptions{SuccessThreshold: 1.5}, true},
+		{"bad start time", RolloutOptions{SuccessThreshold: 1, StartAt: "tomorrow"}, true},
+		{"bad window", RolloutOptions{SuccessThreshold: 1, Window: &models.MaintenanceWindow{Cron: "nope", Duration: "1h"}}, true},
+		{"bad stage", RolloutOptions{SuccessThreshold: 1, Waves: []string{"some"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ValidateRolloutOptions([]string{"a", "b"}, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateRolloutOptions error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidRollout) {
+				t.Errorf("ValidateRolloutOptions error = %v, want ErrInvalidRollout", err)
+			}
+		})
+	}
+}
+
+func TestTallyWave(t *testing.T) {
+	recent := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	stale := time.Now().Add(-2 * unreportedTimeout).UTC().Format(time.RFC3339)
+	job := func(createdAt string, devices ...models.DeviceStatus) models.FlashJob {
+		return models.FlashJob{CreatedAt: createdAt, Status: models.FlashJobStatus{Devices: devices}}
+	}
+	device := func(uuid, phase string) models.DeviceStatus {
+		return models.DeviceStatus{UUID: uuid, Phase: phase}
+	}
+	tests := []struct {
+		name              string
+		uuids             []string
+		job               models.FlashJob
+		succeeded, failed int
+		done              bool
+	}{
+		{"no status yet", []string{"a", "b"}, job(recent), 0, 0, false},
+		{"all succeeded", []string{"a", "b"}, job(recent, device("a", "Succeeded"), device("b", "completed")), 2, 0, true},
+		{"one failed", []string{"a", "b"}, job(recent, device("a", "Succeeded"), device("b", "Error")), 1, 1, true},
+		{"one still running", []string{"a", "b"}, job(recent, device("a", "Succeeded"), device("b", "Running")), 1, 0, false},
+		{"device missing from status", []string{"a", "b"}, job(recent, device("a", "Succeeded")), 1, 0, false},
+		{"unknown while recent", []string{"a"}, job(recent, device("a", phaseUnknown)), 0, 0, false},
+		{"unknown for too long fails", []string{"a", "b"}, job(stale, device("a", phaseUnknown), device("b", "Succeeded")), 1, 1, true},
+		{"devices outside the wave are ignored", []string{"a"}, job(recent, device("a", "Succeeded"), device("z", "Failed")), 1, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			succeeded, failed, done := tallyWave(tt.uuids, tt.job)
+			if succeeded != tt.succeeded || failed != tt.failed || done != tt.done {
+				t.Errorf("tallyWave = (%d, %d, %v), want (%d, %d, %v)", succeeded, failed, done, tt.succeeded, tt.failed, tt.done)
+			}
+		})
+	}
+}
+
+func TestMeetsThreshold(t *testing.T) {
+	tests := []struct {
+		succeeded, total int
+		threshold        float64
+		want             bool
+	}{
+		{1, 1, 1, true},
+		{0, 1, 1, false},
+		{9, 10, 1, false},
+		{9, 10, 0.9, true},
+		{8, 10, 0.9, false},
+		{1, 3, 0.3, true},
+		{0, 3, 0.3, false},
+	}
+	for _, tt := range tests {
+		if got := meetsThreshold(tt.succeeded, tt.total, tt.threshold); got != tt.want {
+			t.Errorf("meetsThreshold(%d, %d, %v) = %v, want %v", tt.succeeded, tt.total, tt.threshold, got, tt.want)
+		}
+	}
+}
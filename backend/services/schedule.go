@@ -0,0 +1,58 @@
+package services
+
+import (
+	"fmt"
+	"time"
+	// Embedded so maintenance window timezones resolve in images without
+	// a zoneinfo database.
+	_ "time/tzdata"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+	"github.com/robfig/cron/v3"
+)
+
+// validateWindow checks that the window's cron expression, duration and
+// timezone all parse.
+func validateWindow(window *models.MaintenanceWindow) error {
+	_, _, _, err := parseWindow(window)
+	return err
+}
+
+func parseWindow(window *models.MaintenanceWindow) (cron.Schedule, time.Duration, *time.Location, error) {
+	schedule, err := cron.ParseStandard(window.Cron)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("%w: window cron %q: %v", ErrInvalidRollout, window.Cron, err)
+	}
+	duration, err := time.ParseDuration(window.Duration)
+	if err != nil || duration <= 0 {
+		return nil, 0, nil, fmt.Errorf("%w: window duration %q must be a positive duration such as \"6h\"", ErrInvalidRollout, window.Duration)
+	}
+	timezone := window.Timezone
+	if timezone == "" {
+		timezone = "UTC"
+	}
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("%w: window timezone %q: %v", ErrInvalidRollout, timezone, err)
+	}
+	return schedule, duration, location, nil
+}
+
+// windowOpen reports whether now falls inside the window and, when it does
+// not, when the window next opens. A nil window is always open.
+func windowOpen(window *models.MaintenanceWindow, now time.Time) (bool, time.Time, error) {
+	if window == nil {
+		return true, time.Time{}, nil
+	}
+	schedule, duration, location, err := parseWindow(window)
+	if err != nil {
+		return false, time.Time{}, err
+	}
+	now = now.In(location)
+	// The window is open when it was last opened less than duration ago,
+	// that is when the first opening after now-duration is not after now.
+	if opened := schedule.Next(now.Add(-duration)); !opened.After(now) {
+		return true, time.Time{}, nil
+	}
+	return false, schedule.Next(now), nil
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+func TestWindowOpen(t *testing.T) {
+	at := func(value string) time.Time {
+		t.Helper()
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+	nightly := &models.MaintenanceWindow{Cron: "0 2 * * *", Duration: "4h"}
+	athens := &models.MaintenanceWindow{Cron: "0 2 * * *", Duration: "4h", Timezone: "Europe/Athens"}
+	weekends := &models.MaintenanceWindow{Cron: "0 0 * * 6", Duration: "48h"}
+	tests := []struct {
+		name     string
+		window   *models.MaintenanceWindow
+		now      string
+		open     bool
+		nextOpen string
+	}{
+		{"no window", nil, "2026-03-04T12:00:00Z", true, ""},
+		{"as it opens", nightly, "2026-03-04T02:00:00Z", true, ""},
+		{"inside", nightly, "2026-03-04T05:59:59Z", true, ""},
+		{"as it closes", nightly, "2026-03-04T06:00:00Z", false, "2026-03-05T02:00:00Z"},
+		{"before it opens", nightly, "2026-03-04T01:00:00Z", false, "2026-03-04T02:00:00Z"},
+		{"in the window's timezone", athens, "2026-03-04T00:30:00Z", true, ""},
+		{"closed in the window's timezone", athens, "2026-03-04T04:30:00Z", false, "2026-03-05T00:00:00Z"},
+		{"spanning days", weekends, "2026-03-08T23:00:00Z", true, ""},
+		{"after a multi-day window", weekends, "2026-03-09T00:00:00Z", false, "2026-03-14T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			open, next, err := windowOpen(tt.window, at(tt.now))
+			if err != nil {
+				t.Fatalf("windowOpen: %v", err)
+			}
+			if open != tt.open {
+				t.Fatalf("windowOpen open = %v, want %v", open, tt.open)
+			}
+			if tt.nextOpen != "" && !next.Equal(at(tt.nextOpen)) {
+				t.Errorf("windowOpen next = %s, want %s", next.UTC().Format(time.RFC3339), tt.nextOpen)
+			}
+		})
+	}
+}
+
+func TestValidateWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  models.MaintenanceWindow
+		wantErr bool
+	}{
+		{"valid", models.MaintenanceWindow{Cron: "30 1 * * 1-5", Duration: "90m", Timezone: "America/New_York"}, false},
+		{"utc by default", models.MaintenanceWindow{Cron: "@daily", Duration: "1h"}, false},
+		{"bad cron", models.MaintenanceWindow{Cron: "61 * * * *", Duration: "1h"}, true},
+		{"missing duration", models.MaintenanceWindow{Cron: "0 2 * * *"}, true},
+		{"negative duration", models.MaintenanceWindow{Cron: "0 2 * * *", Duration: "-1h"}, true},
+		{"unknown timezone", models.MaintenanceWindow{Cron: "0 2 * * *", Duration: "1h", Timezone: "Mars/Olympus"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateWindow(&tt.window); (err != nil) != tt.wantErr {
+				t.Errorf("validateWindow error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
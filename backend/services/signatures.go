@@ -0,0 +1,230 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+var (
+	ErrUnsignedFirmware = errors.New("firmware is not signed")
+	ErrInvalidSignature = errors.New("firmware signature is not valid for any trusted key")
+)
+
+const (
+	// cosignSignatureAnnotation holds the base64 signature of a cosign
+	// signature layer; the layer itself is the signed payload.
+	cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+	cosignPayloadMediaType    = "application/vnd.dev.cosign.simplesigning.v1+json"
+)
+
+type trustedKey struct {
+	name string
+	key  crypto.PublicKey
+}
+
+// SignatureVerifier checks cosign-style signatures: a "sha256-<hex>.sig" tag
+// next to the image whose layers are simple-signing payloads naming the
+// image digest, each signed by one of the trusted ed25519 or ECDSA keys.
+type SignatureVerifier struct {
+	required bool
+	keys     []trustedKey
+	registry *RegistryClient
+	redis    *RedisService
+	logger   *log.Logger
+}
+
+// NewSignatureVerifier loads every PEM public key (*.pem, *.pub) in
+// keysDir. When required is set, rollouts of firmware without a valid
+// signature are refused, and at least one key must load since otherwise
+// every rollout would be.
+func NewSignatureVerifier(required bool, keysDir string, registry *RegistryClient, redis *RedisService, logger *log.Logger) (*SignatureVerifier, error) {
+	verifier := &SignatureVerifier{required: required, registry: registry, redis: redis, logger: logger}
+	entries, err := os.ReadDir(keysDir)
+	if keysDir == "" || errors.Is(err, os.ErrNotExist) {
+		if required {
+			return nil, fmt.Errorf("firmware signature verification is on but trusted keys directory %q does not exist", keysDir)
+		}
+		logger.Printf("Trusted keys directory %q does not exist, no firmware signing keys loaded", keysDir)
+		return verifier, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if entry.IsDir() || (ext != ".pem" && ext != ".pub") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(keysDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		key, err := parsePublicKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("trusted key %s: %w", entry.Name(), err)
+		}
+		verifier.keys = append(verifier.keys, trustedKey{name: strings.TrimSuffix(entry.Name(), ext), key: key})
+	}
+	if required && len(verifier.keys) == 0 {
+		return nil, fmt.Errorf("firmware signature verification is on but %s holds no trusted keys", keysDir)
+	}
+	sort.Slice(verifier.keys, func(i, j int) bool { return verifier.keys[i].name < verifier.keys[j].name })
+	logger.Printf("Loaded %d trusted firmware signing keys", len(verifier.keys))
+	return verifier, nil
+}
+
+func parsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %T, use ed25519 or ECDSA", key)
+}
+
+// Required reports whether rollouts must pass verification.
+func (v *SignatureVerifier) Required() bool {
+	return v.required
+}
+
+// Verify checks the signature of the firmware image and writes the outcome
+// to the audit log. It returns image pinned to the digest that was verified,
+// which is what must be flashed: the tag may move after the check.
+func (v *SignatureVerifier) Verify(image string) (string, error) {
+	ref, keyName, err := v.verify(image)
+	message := fmt.Sprintf("Signature check passed for firmware %s, signed by trusted key %s", ref, keyName)
+	if err != nil {
+		message = fmt.Sprintf("Signature check failed for firmware %s: %v", image, err)
+	}
+	v.logger.Println(message)
+	v.redis.LPushList("logs", models.LogEntry{
+		Timestamp: time.Now().Unix(),
+		Message:   message,
+		Type:      "signature",
+	})
+	v.redis.SetExpiration("logs", 48*time.Hour)
+	if err != nil {
+		return "", err
+	}
+	return ref.String(), nil
+}
+
+// verify returns the resolved reference of image and the name of the key
+// that signed it.
+func (v *SignatureVerifier) verify(image string) (ImageReference, string, error) {
+	if len(v.keys) == 0 {
+		return ImageReference{}, "", fmt.Errorf("%w: no trusted keys are configured", ErrInvalidSignature)
+	}
+	ref, err := v.registry.Resolve(image)
+	if err != nil {
+		return ImageReference{}, "", err
+	}
+
+	signatures := ImageReference{
+		Registry:   ref.Registry,
+		Repository: ref.Repository,
+		Tag:        strings.Replace(ref.Digest, ":", "-", 1) + ".sig",
+	}
+	data, err := v.registry.Manifest(signatures)
+	if errors.Is(err, ErrImageNotFound) {
+		return ref, "", fmt.Errorf("%w: no signature found at %s", ErrUnsignedFirmware, signatures)
+	}
+	if err != nil {
+		return ref, "", err
+	}
+	var manifest struct {
+		Layers []struct {
+			MediaType   string            `json:"mediaType"`
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return ref, "", fmt.Errorf("%w: unreadable signature manifest: %v", ErrInvalidSignature, err)
+	}
+
+	signed := false
+	for _, layer := range manifest.Layers {
+		encoded, ok := layer.Annotations[cosignSignatureAnnotation]
+		if !ok || layer.MediaType != cosignPayloadMediaType {
+			continue
+		}
+		signed = true
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		payload, err := v.registry.Blob(signatures, layer.Digest)
+		if err != nil {
+			return ref, "", err
+		}
+		if payloadDigest(payload) != ref.Digest {
+			continue
+		}
+		if keyName, ok := v.trustedSigner(payload, signature); ok {
+			return ref, keyName, nil
+		}
+	}
+	if !signed {
+		return ref, "", fmt.Errorf("%w: %s holds no signatures", ErrUnsignedFirmware, signatures)
+	}
+	return ref, "", ErrInvalidSignature
+}
+
+// payloadDigest returns the image digest a simple-signing payload vouches
+// for.
+func payloadDigest(payload []byte) string {
+	var simpleSigning struct {
+		Critical struct {
+			Image struct {
+				DockerManifestDigest string `json:"docker-manifest-digest"`
+			} `json:"image"`
+		} `json:"critical"`
+	}
+	if err := json.Unmarshal(payload, &simpleSigning); err != nil {
+		return ""
+	}
+	return simpleSigning.Critical.Image.DockerManifestDigest
+}
+
+// trustedSigner returns the trusted key that signed payload. ed25519 keys
+// sign the payload itself, ECDSA keys its SHA-256 digest.
+func (v *SignatureVerifier) trustedSigner(payload, signature []byte) (string, bool) {
+	digest := sha256.Sum256(payload)
+	for _, trusted := range v.keys {
+		switch key := trusted.key.(type) {
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, signature) {
+				return trusted.name, true
+			}
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, digest[:], signature) {
+				return trusted.name, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,244 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var discardLogger = log.New(io.Discard, "", 0)
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func publicKeyPEM(t *testing.T, key crypto.PublicKey) []byte {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func writeKeys(t *testing.T, files map[string][]byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestNewSignatureVerifier(t *testing.T) {
+	edKey, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string][]byte{
+		"release.pub": publicKeyPEM(t, edKey),
+		"ci.pem":      publicKeyPEM(t, &ecKey.PublicKey),
+		"README.md":   []byte("not a key"),
+	}
+	tests := []struct {
+		name     string
+		required bool
+		dir      string
+		wantKeys []string
+		wantErr  bool
+	}{
+		{"loads ed25519 and ECDSA keys", true, writeKeys(t, keys), []string{"ci", "release"}, false},
+		{"missing directory when optional", false, filepath.Join(t.TempDir(), "missing"), nil, false},
+		{"missing directory when required", true, filepath.Join(t.TempDir(), "missing"), nil, true},
+		{"empty directory when optional", false, t.TempDir(), nil, false},
+		{"empty directory when required", true, t.TempDir(), nil, true},
+		{"unreadable key", false, writeKeys(t, map[string][]byte{"bad.pem": []byte("garbage")}), nil, true},
+		{"unsupported key type", false, writeKeys(t, map[string][]byte{"rsa.pem": publicKeyPEM(t, &rsaKey.PublicKey)}), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifier, err := NewSignatureVerifier(tt.required, tt.dir, nil, nil, discardLogger)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewSignatureVerifier error = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			var names []string
+			for _, key := range verifier.keys {
+				names = append(names, key.name)
+			}
+			if strings.Join(names, ",") != strings.Join(tt.wantKeys, ",") {
+				t.Errorf("loaded keys %v, want %v", names, tt.wantKeys)
+			}
+		})
+	}
+}
+
+// signatureLayer is one cosign signature of a simple-signing payload.
+type signatureLayer struct {
+	payload   []byte
+	signature string
+	mediaType string
+}
+
+// fakeSignedRegistry serves the image fw/app:v1 and, unless layers is
+// nil, a cosign signature manifest holding layers. It returns a client for
+// it and its host.
+func fakeSignedRegistry(t *testing.T, imageDigest string, layers []signatureLayer) (*RegistryClient, string) {
+	t.Helper()
+	routes := map[string][]byte{}
+	if layers != nil {
+		type layer struct {
+			MediaType   string            `json:"mediaType"`
+			Digest      string            `json:"digest"`
+			Annotations map[string]string `json:"annotations"`
+		}
+		manifest := struct {
+			Layers []layer `json:"layers"`
+		}{Layers: []layer{}}
+		for _, l := range layers {
+			digest := sha256Digest(l.payload)
+			routes["/v2/fw/app/blobs/"+digest] = l.payload
+			manifest.Layers = append(manifest.Layers, layer{
+				MediaType:   l.mediaType,
+				Digest:      digest,
+				Annotations: map[string]string{cosignSignatureAnnotation: l.signature},
+			})
+		}
+		data, err := json.Marshal(manifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		routes["/v2/fw/app/manifests/"+strings.Replace(imageDigest, ":", "-", 1)+".sig"] = data
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/fw/app/manifests/v1" {
+			w.Header().Set("Docker-Content-Digest", imageDigest)
+			return
+		}
+		data, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	host := strings.TrimPrefix(server.URL, "http://")
+	client, err := NewRegistryClient(false, "", []string{host}, nil, discardLogger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, host
+}
+
+func TestSignatureVerifierVerify(t *testing.T) {
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecPrivate, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, untrusted, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusted := writeKeys(t, map[string][]byte{
+		"release.pub": publicKeyPEM(t, edPublic),
+		"ci.pem":      publicKeyPEM(t, &ecPrivate.PublicKey),
+	})
+
+	imageDigest := sha256Digest([]byte("firmware manifest"))
+	payloadFor := func(digest string) []byte {
+		return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"fw/app"},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, digest))
+	}
+	payload := payloadFor(imageDigest)
+	signEd25519 := func(key ed25519.PrivateKey, payload []byte) string {
+		return base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	}
+	payloadHash := sha256.Sum256(payload)
+	ecSignature, err := ecdsa.SignASN1(rand.Reader, ecPrivate, payloadHash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPayload := payloadFor(sha256Digest([]byte("other manifest")))
+
+	tests := []struct {
+		name    string
+		keysDir string
+		layers  []signatureLayer
+		wantKey string
+		wantErr error
+	}{
+		{"ed25519 signature", trusted, []signatureLayer{{payload, signEd25519(edPrivate, payload), cosignPayloadMediaType}}, "release", nil},
+		{"ECDSA signature", trusted, []signatureLayer{{payload, base64.StdEncoding.EncodeToString(ecSignature), cosignPayloadMediaType}}, "ci", nil},
+		{"any valid layer is enough", trusted, []signatureLayer{
+			{payload, signEd25519(untrusted, payload), cosignPayloadMediaType},
+			{payload, signEd25519(edPrivate, payload), cosignPayloadMediaType},
+		}, "release", nil},
+		{"untrusted key", trusted, []signatureLayer{{payload, signEd25519(untrusted, payload), cosignPayloadMediaType}}, "", ErrInvalidSignature},
+		{"signature of another image", trusted, []signatureLayer{{otherPayload, signEd25519(edPrivate, otherPayload), cosignPayloadMediaType}}, "", ErrInvalidSignature},
+		{"undecodable signature", trusted, []signatureLayer{{payload, "%%%", cosignPayloadMediaType}}, "", ErrInvalidSignature},
+		{"no signature tag", trusted, nil, "", ErrUnsignedFirmware},
+		{"no signature layers", trusted, []signatureLayer{{payload, signEd25519(edPrivate, payload), "application/octet-stream"}}, "", ErrUnsignedFirmware},
+		{"no trusted keys", t.TempDir(), []signatureLayer{{payload, signEd25519(edPrivate, payload), cosignPayloadMediaType}}, "", ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, host := fakeSignedRegistry(t, imageDigest, tt.layers)
+			verifier, err := NewSignatureVerifier(false, tt.keysDir, registry, nil, discardLogger)
+			if err != nil {
+				t.Fatalf("NewSignatureVerifier: %v", err)
+			}
+			ref, keyName, err := verifier.verify(host + "/fw/app:v1")
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("verify error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+			if keyName != tt.wantKey {
+				t.Errorf("verify signed by %q, want %q", keyName, tt.wantKey)
+			}
+			if ref.Digest != imageDigest {
+				t.Errorf("verify pinned %s, want %s", ref, imageDigest)
+			}
+		})
+	}
+}
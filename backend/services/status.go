@@ -0,0 +1,224 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/pmavrikos/cloud-native-iot-UI/backend/models"
+)
+
+// brokerInstanceLabel is set by the Akri agent on every broker pod it starts,
+// with the instance name as value.
+const brokerInstanceLabel = "akri.sh/instance"
+
+var podGVR = schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+
+// Where devices report the firmware they run, first match wins: broker
+// property keys, then instance annotations.
+var (
+	currentFirmwareProperties = []string{"CURRENT_FIRMWARE", "FIRMWARE", "FIRMWARE_IMAGE"}
+	currentVersionProperties  = []string{"CURRENT_VERSION", "FIRMWARE_VERSION"}
+)
+
+const (
+	currentFirmwareAnnotation = "flashjob.nbfc.io/current-firmware"
+	currentVersionAnnotation  = "flashjob.nbfc.io/current-version"
+)
+
+// terminalPhases are the FlashJob and device phases after which nothing more
+// happens to a device; every other phase counts as in flight.
+var terminalPhases = map[string]bool{
+	"succeeded": true,
+	"completed": true,
+	"failed":    true,
+	"error":     true,
+}
+
+func isTerminalPhase(phase string) bool {
+	return terminalPhases[strings.ToLower(phase)]
+}
+
+// phaseUnknown is the phase of a FlashJob the operator has not written a
+// status for. Its devices count as in flight for unreportedTimeout after
+// the FlashJob was created, then no longer, so a FlashJob the operator never
+// picks up does not keep them flashing forever.
+const (
+	phaseUnknown      = "Unknown"
+	unreportedTimeout = 30 * time.Minute
+)
+
+// inFlight reports whether a device of job in phase may still change.
+func inFlight(job models.FlashJob, phase string) bool {
+	if isTerminalPhase(phase) {
+		return false
+	}
+	if phase != phaseUnknown {
+		return true
+	}
+	created, err := time.Parse(time.RFC3339, job.CreatedAt)
+	return err == nil && time.Since(created) < unreportedTimeout
+}
+
+// deviceStatus derives an instance's state from, in order: an in-flight
+// FlashJob for its UUID, the nodes that can still see it, whether a broker
+// pod is running for it when its Configuration asks for one and whether any
+// deviceUsage slot is taken.
+func (s *KubernetesService) deviceStatus(item *unstructured.Unstructured, uuid string, flashing map[string]bool) string {
+	if flashing[uuid] {
+		return models.StatusFlashing
+	}
+	nodes, _, _ := unstructured.NestedStringSlice(item.Object, "spec", "nodes")
+	if len(nodes) == 0 {
+		return models.StatusUnreachable
+	}
+	if s.wantsBroker(item) {
+		if running, known := s.brokerRunning(item.GetNamespace(), item.GetName()); known && !running {
+			return models.StatusOrphaned
+		}
+	}
+	usage, _, _ := unstructured.NestedMap(item.Object, "spec", "deviceUsage")
+	for _, node := range usage {
+		if node, ok := node.(string); ok && node != "" {
+			return models.StatusBusy
+		}
+	}
+	return models.StatusActive
+}
+
+// wantsBroker reports whether the cached Configuration of the instance has a
+// brokerSpec. Without one Akri starts no broker pods, so none running is not
+// a fault.
+func (s *KubernetesService) wantsBroker(item *unstructured.Unstructured) bool {
+	lister, ok := s.configurationListers[metav1.NamespaceAll]
+	if !ok {
+		lister, ok = s.configurationListers[item.GetNamespace()]
+	}
+	if !ok {
+		return false
+	}
+	name, _, _ := unstructured.NestedString(item.Object, "spec", "configurationName")
+	obj, err := lister.ByNamespace(item.GetNamespace()).Get(name)
+	if err != nil {
+		return false
+	}
+	configuration, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return false
+	}
+	_, hasBroker, _ := unstructured.NestedMap(configuration.Object, "spec", "brokerSpec")
+	return hasBroker
+}
+
+// brokerRunning reports whether a broker pod for the instance is running.
+// known is false when broker pods are not cached for the namespace.
+func (s *KubernetesService) brokerRunning(namespace, instanceName string) (running, known bool) {
+	pods, known := s.brokerPods(namespace, instanceName)
+	for _, pod := range pods {
+		if phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase"); phase == "Running" {
+			return true, true
+		}
+	}
+	return false, known
+}
+
+// brokerPods returns the cached broker pods of an instance. ok is false when
+// broker pods are not cached for the namespace.
+func (s *KubernetesService) brokerPods(namespace, instanceName string) (pods []*unstructured.Unstructured, ok bool) {
+	lister, ok := s.brokerPodListers[metav1.NamespaceAll]
+	if !ok {
+		lister, ok = s.brokerPodListers[namespace]
+	}
+	if !ok {
+		return nil, false
+	}
+	selector := labels.SelectorFromSet(labels.Set{brokerInstanceLabel: instanceName})
+	objects, err := lister.ByNamespace(namespace).List(selector)
+	if err != nil {
+		s.logger.Printf("Failed to list broker pods for instance %s: %v", instanceName, err)
+		return nil, false
+	}
+	for _, obj := range objects {
+		if pod, ok := obj.(*unstructured.Unstructured); ok {
+			pods = append(pods, pod)
+		}
+	}
+	return pods, true
+}
+
+func brokerPodFromUnstructured(pod *unstructured.Unstructured) models.BrokerPod {
+	phase, _, _ := unstructured.NestedString(pod.Object, "status", "phase")
+	nodeName, _, _ := unstructured.NestedString(pod.Object, "spec", "nodeName")
+	startTime, _, _ := unstructured.NestedString(pod.Object, "status", "startTime")
+	conditions, _, _ := unstructured.NestedSlice(pod.Object, "status", "conditions")
+	ready := false
+	for _, condition := range conditions {
+		if c, ok := condition.(map[string]interface{}); ok && c["type"] == "Ready" && c["status"] == "True" {
+			ready = true
+		}
+	}
+	return models.BrokerPod{
+		Name:      pod.GetName(),
+		Namespace: pod.GetNamespace(),
+		Phase:     phase,
+		NodeName:  nodeName,
+		Ready:     ready,
+		StartTime: startTime,
+	}
+}
+
+// flashJobIndex is what the cached FlashJobs say about each device: whether
+// a FlashJob for it is still in flight.
+type flashJobIndex struct {
+	flashing map[string]bool
+}
+
+// indexFlashJobs builds the flashJobIndex from the FlashJob cache.
+func (s *KubernetesService) indexFlashJobs() flashJobIndex {
+	index := flashJobIndex{flashing: map[string]bool{}}
+	for _, lister := range s.flashJobListers {
+		objects, err := lister.List(labels.Everything())
+		if err != nil {
+			s.logger.Printf("Failed to list FlashJobs from cache: %v", err)
+			continue
+		}
+		for _, obj := range objects {
+			item, ok := obj.(*unstructured.Unstructured)
+			if !ok {
+				continue
+			}
+			job := flashJobFromUnstructured(s.name, item)
+			for _, device := range job.Status.Devices {
+				if inFlight(job, device.Phase) {
+					index.flashing[device.UUID] = true
+				}
+			}
+		}
+	}
+	return index
+}
+
+// currentFirmware reports what the device runs: what it reports itself in
+// its brokerProperties or, failing that, the instance annotations, else the
+// firmware last flashed onto it successfully, without its digest so it reads
+// as the catalog image.
+func (s *KubernetesService) currentFirmware(item *unstructured.Unstructured, props map[string]string) (firmware, version, source string) {
+	firmware = firstProperty(props, currentFirmwareProperties)
+	version = firstProperty(props, currentVersionProperties)
+	if firmware != "" || version != "" {
+		return firmware, version, models.FirmwareFromProperties
+	}
+	annotations := item.GetAnnotations()
+	firmware, version = annotations[currentFirmwareAnnotation], annotations[currentVersionAnnotation]
+	if firmware != "" || version != "" {
+		return firmware, version, models.FirmwareFromAnnotations
+	}
+	if last, ok := s.history.LastFlashed(string(item.GetUID())); ok {
+		return withoutDigest(last.Firmware), last.Version, models.FirmwareFromFlashJob
+	}
+	return "", "", ""
+}